@@ -0,0 +1,70 @@
+package spt
+
+import (
+	"math"
+)
+
+// pixels need this many rays before their noise estimate is trusted
+const adaptiveMinRays = 8
+
+// Relative standard error of the pixel's mean brightness. Dark pixels are
+// measured against a floor so a few stray fireflies don't dominate.
+func (p Pixel) Noise() float64 {
+	if p.Rays < 2 {
+		return math.Inf(1)
+	}
+	// the unbiased variance over n
+	mean, variance := p.spread()
+	return math.Sqrt(variance/float64(p.Rays-1)) / max(mean, 0.05)
+}
+
+// The mean and variance of the brightness of the pixel's own samples,
+// which unlike its filtered color don't include its neighbours'.
+func (p *Pixel) spread() (float64, float64) {
+	n := float64(p.Rays)
+	mean := p.Sum / n
+	return mean, max(0, p.Square/n-mean*mean)
+}
+
+// Per-pixel samples for the next pass, spending the usual Samples per
+// pixel across the image in proportion to each pixel's noise. Pixels
+// already below Scene.Noise get none. Also reports whether every pixel
+// has converged, which is never true without a Noise target. No pixel
+// gets more than MaxSamples.
+func (scene *Scene) plan() ([]uint16, bool) {
+	noise := make([]float64, len(scene.Raster))
+	total := 0.0
+	for i, p := range scene.Raster {
+		n := p.Noise()
+		switch {
+		case p.Rays < adaptiveMinRays:
+			n = math.Inf(1)
+		case scene.Noise > 0 && n < scene.Noise:
+			n = 0
+		}
+		noise[i] = n
+		if !math.IsInf(n, 1) {
+			total += n
+		}
+	}
+
+	budget := make([]uint16, len(scene.Raster))
+	spend := float64(scene.Samples * len(scene.Raster))
+	converged := scene.Noise > 0
+
+	// untrusted pixels get the usual samples, the rest share what's left
+	for i, n := range noise {
+		if math.IsInf(n, 1) {
+			budget[i] = uint16(min(float64(scene.Samples), MaxSamples))
+			spend -= float64(budget[i])
+			converged = false
+		}
+	}
+	for i, n := range noise {
+		if n > 0 && !math.IsInf(n, 1) {
+			budget[i] = uint16(clamp(math.Ceil(max(spend, 0)*n/total), 1, MaxSamples))
+			converged = false
+		}
+	}
+	return budget, converged
+}
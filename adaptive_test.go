@@ -0,0 +1,145 @@
+package spt
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+func samplePixel(samples ...float64) Pixel {
+	var p Pixel
+	for _, s := range samples {
+		c := White.Scale(s)
+		p.Color = p.Color.Add(c)
+		p.Sum += c.Brightness()
+		p.Square += c.Brightness() * c.Brightness()
+		p.Rays++
+	}
+	return p
+}
+
+func TestPixelNoise(t *testing.T) {
+	if n := samplePixel(0.5, 0.5, 0.5, 0.5).Noise(); n > 1e-6 {
+		t.Errorf("flat pixel noise %v", n)
+	}
+	if n := samplePixel(0.5).Noise(); !math.IsInf(n, 1) {
+		t.Errorf("single sample noise %v", n)
+	}
+	// a flat pixel beside a dark one, whose filtered color it shares
+	edge := samplePixel(0.9, 0.9, 0.9, 0.9)
+	edge.Color, edge.Weight = White.Scale(0.5*3), 3
+	if n := edge.Noise(); n > 1e-6 {
+		t.Errorf("flat pixel on an edge has noise %v", n)
+	}
+
+	a := samplePixel(0.1, 0.9, 0.1, 0.9)
+	b := samplePixel(0.1, 0.9, 0.1, 0.9, 0.1, 0.9, 0.1, 0.9)
+	if a.Noise() <= b.Noise() {
+		t.Errorf("more samples, more noise: %v <= %v", a.Noise(), b.Noise())
+	}
+
+	// merging keeps what's needed for variance
+	scene := Scene{Width: 1, Height: 1, Raster: Raster{a}}
+	scene.Merge(Raster{a})
+	if n := scene.Raster[0].Noise(); abs(n-b.Noise()) > 1e-9 {
+		t.Errorf("merged noise %v, want %v", n, b.Noise())
+	}
+}
+
+func TestPlan(t *testing.T) {
+	flat := samplePixel(0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5)
+	noisy := samplePixel(0.1, 0.9, 0.1, 0.9, 0.1, 0.9, 0.1, 0.9)
+	noisier := samplePixel(0.0, 1.0, 0.0, 1.0, 0.0, 1.0, 0.0, 1.0)
+	fresh := samplePixel(0.5)
+
+	scene := Scene{Width: 4, Height: 1, Samples: 4, Adaptive: true, Raster: Raster{flat, noisy, noisier, fresh}}
+	budget, converged := scene.plan()
+	if converged {
+		t.Errorf("converged without a noise target")
+	}
+	if budget[0] > 1 || budget[1] == 0 || budget[2] <= budget[1] || budget[3] != 4 {
+		t.Errorf("budget %v", budget)
+	}
+
+	// more than a byte's worth of samples
+	scene.Samples = 300
+	if budget, _ = scene.plan(); budget[3] != 300 || budget[2] <= 255 {
+		t.Errorf("budget %v of 300 samples", budget)
+	}
+
+	scene.Samples = 4
+	scene.Noise = 0.1
+	scene.Raster = Raster{flat, flat, noisy, flat}
+	budget, converged = scene.plan()
+	if converged || budget[0] != 0 || budget[2] == 0 {
+		t.Errorf("budget %v, converged %v", budget, converged)
+	}
+	scene.Raster = Raster{flat, flat, flat, flat}
+	if _, converged = scene.plan(); !converged {
+		t.Errorf("flat image not converged")
+	}
+}
+
+func TestRenderNoise(t *testing.T) {
+	scene := tinyScene()
+	scene.Samples = 4
+	scene.Noise = 0.2
+
+	var last *Scene
+	frames := 0
+	for frame := range RenderContext(context.Background(), scene, []Renderer{NewLocalRenderer(), NewLocalRenderer()}, RenderOptions{
+		Deadline: time.Now().Add(30 * time.Second),
+	}) {
+		last = frame.(*Scene)
+		frames++
+	}
+
+	if last == nil {
+		t.Fatal("no frames")
+	}
+	_, converged := last.plan()
+	if !converged {
+		t.Fatalf("stopped after %d passes without converging", frames)
+	}
+
+	// effort went where the noise was
+	lo, hi := int32(math.MaxInt32), int32(0)
+	for _, p := range last.Raster {
+		if p.Rays < lo {
+			lo = p.Rays
+		}
+		if p.Rays > hi {
+			hi = p.Rays
+		}
+	}
+	if hi <= lo {
+		t.Errorf("every pixel got %d rays", lo)
+	}
+}
+
+func TestRPCVariance(t *testing.T) {
+	scene := tinyScene()
+	scene.Samples = 2
+	scene.Budget = make([]uint16, scene.Width*scene.Height)
+	scene.Budget[0] = 7
+
+	var cr CompressedRaster
+	if err := (RenderRPC{}).Render(scene, &cr); err != nil {
+		t.Fatal(err)
+	}
+	raster := make(Raster, scene.Width*scene.Height)
+	if err := binary.Read(flate.NewReader(bytes.NewReader(cr.Buf)), binary.LittleEndian, raster); err != nil {
+		t.Fatal(err)
+	}
+
+	if raster[0].Rays != 7 || raster[1].Rays != 0 {
+		t.Errorf("budget ignored: %d and %d rays", raster[0].Rays, raster[1].Rays)
+	}
+	if raster[0].Square <= 0 && raster[0].Color != Naught {
+		t.Errorf("squared samples lost on the wire")
+	}
+}
@@ -0,0 +1,175 @@
+package spt
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// The AOVs a Scene records when AOV is set, by layer name.
+const (
+	LayerDepth    = "depth"    // distance from the camera
+	LayerNormal   = "normal"   // world normal, each axis -1..1
+	LayerAlbedo   = "albedo"   // base color of the material
+	LayerObject   = "object"   // 1 + index in Scene.Stuff, 0 for nothing
+	LayerMaterial = "material" // 1 + index among the scene's distinct materials
+)
+
+var Layers = []string{LayerDepth, LayerNormal, LayerAlbedo, LayerObject, LayerMaterial}
+
+// Materials may say what their base color is; those with an embedded
+// Color use that.
+type Albedoer interface {
+	Albedo() Color
+}
+
+func albedo(mat Material) Color {
+	var c Color
+	switch m := mat.(type) {
+	case Albedoer:
+		c = m.Albedo()
+	case Diffuse:
+		c = m.Color
+	case Metallic:
+		c = m.Color
+	case Dielectric:
+		c = m.Color
+	case Emitter:
+		c = m.Color
+	case Invisible:
+		c = m.Color
+	}
+	return Clip{}.Map(c)
+}
+
+// One AOV of a rendered scene. Its linear pixels are the raw values, so
+// save it as EXR or PFM to keep them; as PNG, depth is brighter when
+// nearer, normals are shifted into 0..1, and IDs get a color each.
+type layerImage struct {
+	scene   *Scene
+	far     float64 // greatest depth, for display
+	linear  func(p *Pixel) Color
+	display func(c Color) Color
+}
+
+// An AOV of a scene rendered with AOV set, by name from Layers.
+func (scene *Scene) Layer(name string) (LinearImage, error) {
+	l := &layerImage{scene: scene}
+	average := func(v float64, p *Pixel) float64 {
+		return v / float64(p.Hits)
+	}
+	switch name {
+	case LayerDepth:
+		l.linear = func(p *Pixel) Color {
+			d := average(p.Depth, p)
+			return Color{d, d, d}
+		}
+		for i := range scene.Raster {
+			if p := &scene.Raster[i]; p.Hits > 0 {
+				l.far = math.Max(l.far, average(p.Depth, p))
+			}
+		}
+		l.display = func(c Color) Color {
+			v := 1.0
+			if l.far > 0 {
+				v -= c.R / l.far
+			}
+			return Color{v, v, v}
+		}
+	case LayerNormal:
+		l.linear = func(p *Pixel) Color {
+			n := p.Normal.Unit()
+			return Color{n.X, n.Y, n.Z}
+		}
+		l.display = func(c Color) Color {
+			return Color{c.R*0.5 + 0.5, c.G*0.5 + 0.5, c.B*0.5 + 0.5}
+		}
+	case LayerAlbedo:
+		l.linear = func(p *Pixel) Color {
+			return p.Albedo.Scale(1 / float64(p.Hits))
+		}
+		l.display = func(c Color) Color {
+			return Color{SRGB(c.R), SRGB(c.G), SRGB(c.B)}
+		}
+	case LayerObject, LayerMaterial:
+		l.linear = func(p *Pixel) Color {
+			id := float64(p.Object)
+			if name == LayerMaterial {
+				id = float64(p.Material)
+			}
+			return Color{id, id, id}
+		}
+		l.display = idColor
+	default:
+		return nil, fmt.Errorf("unknown layer %q", name)
+	}
+	return l, nil
+}
+
+// a distinct color for each ID, stepping round the hue circle by the
+// golden angle
+func idColor(c Color) Color {
+	h := math.Mod(c.R*0.618033988749895, 1) * 6
+	f := func(n float64) float64 {
+		k := math.Mod(n+h, 6)
+		return 0.9 - 0.6*math.Max(0, math.Min(1, math.Min(k, 4-k)))
+	}
+	return Color{f(5), f(3), f(1)}
+}
+
+func (l *layerImage) Bounds() image.Rectangle {
+	return l.scene.Bounds()
+}
+
+func (l *layerImage) ColorModel() color.Model {
+	return color.NRGBAModel
+}
+
+// Linear values are averaged over the primary rays that hit something,
+// and alpha is the fraction that did.
+func (l *layerImage) Linear(x, y int) (Color, float64) {
+	p := &l.scene.Raster[y*l.scene.Width+x]
+	if p.Hits == 0 {
+		return Naught, 0
+	}
+	return l.linear(p), float64(p.Hits) / float64(p.Rays)
+}
+
+func (l *layerImage) At(x, y int) color.Color {
+	c, alpha := l.Linear(x, y)
+	if alpha == 0 {
+		return Transparent
+	}
+	return displayColor(Clip{}.Map(l.display(c)), alpha)
+}
+
+// Write an EXR with the scene's image and every AOV as layers, such as
+// depth.Z and normal.X.
+func WriteLayers(w io.Writer, scene *Scene) error {
+	channels := rgbaChannels(scene)
+	for _, layer := range []struct {
+		name, channels string
+	}{
+		{LayerDepth, "Z"},
+		{LayerNormal, "XYZ"},
+		{LayerAlbedo, "RGB"},
+		{LayerObject, "id"},
+		{LayerMaterial, "id"},
+	} {
+		img, _ := scene.Layer(layer.name)
+		names := []string{layer.channels}
+		if len(layer.channels) == 3 {
+			names = []string{layer.channels[:1], layer.channels[1:2], layer.channels[2:]}
+		}
+		for i, name := range names {
+			i := i
+			channels = append(channels, exrChannel{layer.name + "." + name, func(x, y int) float32 {
+				c, _ := img.Linear(x, y)
+				return float32([3]float64{c.R, c.G, c.B}[i])
+			}})
+		}
+	}
+	return writeEXR(w, scene.Bounds(), channels)
+}
@@ -0,0 +1,146 @@
+package spt
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func aovScene() Scene {
+	scene := tinyScene()
+	scene.Passes = 2
+	scene.AOV = true
+	// a pixel spans a fair arc of the ball, so average a few samples for a
+	// steady normal, from the same seed every run
+	scene.Samples, scene.Seed = 4, 1
+	// two things sharing a material, to share its ID
+	scene.Stuff = append(scene.Stuff, Object(Steel, Translate(V3(-100000, 0, 0), Sphere(1))))
+	return scene
+}
+
+func renderAOV(t *testing.T, renderer Renderer) *Scene {
+	var last *Scene
+	for frame := range RenderContext(context.Background(), aovScene(), []Renderer{renderer}, RenderOptions{
+		TileSize: 8,
+		Deadline: time.Now().Add(30 * time.Second),
+	}) {
+		last = frame.(*Scene)
+	}
+	if last == nil {
+		t.Fatal("no frames")
+	}
+	return last
+}
+
+func checkAOV(t *testing.T, name string, scene *Scene) {
+	// the steel ball fills the middle of the frame
+	x, y := scene.Width/2, scene.Height/2
+	p := scene.Raster[y*scene.Width+x]
+	if p.Hits != p.Rays || p.Object != 2 || p.Material != 2 {
+		t.Errorf("%s: center %+v", name, p)
+	}
+
+	depth, _ := scene.Layer(LayerDepth)
+	d, _ := depth.Linear(x, y)
+	if want := V3(0, -3000, 3000).Length() - 500; math.Abs(d.R-want) > 50 {
+		t.Errorf("%s: depth %v, want about %v", name, d.R, want)
+	}
+	normal, _ := scene.Layer(LayerNormal)
+	if n, _ := normal.Linear(x, y); math.Abs(V3(n.R, n.G, n.B).Length()-1) > 1e-6 || n.G > -0.5 || n.B < 0.5 {
+		t.Errorf("%s: normal %v", name, n)
+	}
+	albedo, _ := scene.Layer(LayerAlbedo)
+	if a, _ := albedo.Linear(x, y); math.Abs(a.R-0.4) > 1e-9 {
+		t.Errorf("%s: albedo %v", name, a)
+	}
+
+	// the corner sees nothing
+	if c, a := depth.Linear(0, 0); c != Naught || a != 0 {
+		t.Errorf("%s: corner %v %v", name, c, a)
+	}
+}
+
+func TestAOV(t *testing.T) {
+	local := renderAOV(t, NewLocalRenderer())
+	checkAOV(t, "local", local)
+
+	// the same through a worker's compressed rasters
+	addr, _, stop := testWorker(t, newSceneCache(sceneCacheSize))
+	defer stop()
+	renderer := NewRPCRenderer(addr)
+	defer renderer.(RPCRenderer).Close()
+	checkAOV(t, "rpc", renderAOV(t, renderer))
+
+	// the light, and things sharing a material
+	scene := aovScene()
+	scene.prepare()
+	for i, want := range [][2]int32{{0, 0}, {1, 1}, {2, 1}} {
+		if got := [2]int32{scene.Stuff[i].index, scene.Stuff[i].material}; got != want {
+			t.Errorf("stuff[%d] index and material %v, want %v", i, got, want)
+		}
+	}
+
+	// off by default
+	plain := tinyScene()
+	plain.Passes = 1
+	for frame := range RenderContext(context.Background(), plain, nil, RenderOptions{}) {
+		for _, p := range frame.(*Scene).Raster {
+			if p.Hits != 0 || p.Object != 0 {
+				t.Fatalf("AOVs recorded when off: %+v", p)
+			}
+		}
+	}
+
+	if _, err := local.Layer("beauty"); err == nil {
+		t.Error("unknown layer")
+	}
+}
+
+func TestAOVOutput(t *testing.T) {
+	scene := renderAOV(t, NewLocalRenderer())
+
+	buf := new(bytes.Buffer)
+	if err := WriteLayers(buf, scene); err != nil {
+		t.Fatal(err)
+	}
+	_, _, exr, err := readEXR(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"A", "B", "G", "R", "albedo.B", "albedo.G", "albedo.R", "depth.Z",
+		"material.id", "normal.X", "normal.Y", "normal.Z", "object.id"}
+	if len(exr) != len(want) {
+		t.Errorf("%d channels", len(exr))
+	}
+	for _, name := range want {
+		if _, ok := exr[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+	center := scene.Height/2*scene.Width + scene.Width/2
+	if exr["object.id"][center] != 2 || exr["normal.Z"][center] < 0.5 {
+		t.Errorf("center object %v normal z %v", exr["object.id"][center], exr["normal.Z"][center])
+	}
+
+	dir, err := ioutil.TempDir("", "spt-aov")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range Layers {
+		img, err := scene.Layer(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ext := range []string{".png", ".pfm"} {
+			if err := SaveImage(img, filepath.Join(dir, name+ext)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+}
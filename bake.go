@@ -0,0 +1,171 @@
+package spt
+
+import (
+	"encoding/gob"
+	"math"
+	"sync"
+)
+
+func init() {
+	gob.Register(SDFBaked{})
+}
+
+// samples per brick edge, in cells
+const bakeBrick = 8
+
+// An SDF3 sampled onto a sparse grid. The grid covers the bounding sphere
+// and is split into bricks; only bricks near the surface keep their
+// samples, which are interpolated trilinearly. Elsewhere the distance is
+// a conservative lower bound, or the bounding volume distance outside
+// the grid. Baking happens once in Bake and the samples travel with the
+// struct, so cluster workers never re-bake.
+type SDFBaked struct {
+	Center  Vec3
+	Radius  float64
+	Min     Vec3
+	Max     Vec3
+	Origin  Vec3
+	Step    float64
+	Bricks  int                 // per axis
+	Samples map[int32][]float32 // (bakeBrick+1)^3 per near-surface brick
+	Inside  []bool              // per brick, sign of the far-field bricks
+}
+
+func (s SDFBaked) SDF() func(Vec3) float64 {
+	bs := bound{sphere{s.Center, s.Radius}, s.Min, s.Max}
+	cells := float64(s.Bricks * bakeBrick)
+	inv := 1.0 / s.Step
+	// every sample in a missing brick was at least bakeBrick steps from
+	// the surface, so every point in it is at least this far
+	far := float64(bakeBrick-1) * s.Step
+	const n = bakeBrick + 1
+
+	return func(p Vec3) float64 {
+		g := p.Sub(s.Origin).Scale(inv)
+		if g.X < 0 || g.Y < 0 || g.Z < 0 || g.X > cells || g.Y > cells || g.Z > cells {
+			return bs.distance(p)
+		}
+
+		brick := func(v float64) (int, float64) {
+			b := int(v) / bakeBrick
+			if b >= s.Bricks {
+				b = s.Bricks - 1
+			}
+			return b, v - float64(b*bakeBrick)
+		}
+		bx, lx := brick(g.X)
+		by, ly := brick(g.Y)
+		bz, lz := brick(g.Z)
+		id := bx + by*s.Bricks + bz*s.Bricks*s.Bricks
+
+		samples, ok := s.Samples[int32(id)]
+		if !ok {
+			if s.Inside[id] {
+				return -far
+			}
+			return max(far, bs.distance(p))
+		}
+
+		ix, iy, iz := int(lx), int(ly), int(lz)
+		if ix >= bakeBrick {
+			ix = bakeBrick - 1
+		}
+		if iy >= bakeBrick {
+			iy = bakeBrick - 1
+		}
+		if iz >= bakeBrick {
+			iz = bakeBrick - 1
+		}
+		fx, fy, fz := lx-float64(ix), ly-float64(iy), lz-float64(iz)
+
+		at := func(x, y, z int) float64 {
+			return float64(samples[(ix+x)+(iy+y)*n+(iz+z)*n*n])
+		}
+		lerp := func(a, b, t float64) float64 {
+			return a + (b-a)*t
+		}
+
+		c00 := lerp(at(0, 0, 0), at(1, 0, 0), fx)
+		c10 := lerp(at(0, 1, 0), at(1, 1, 0), fx)
+		c01 := lerp(at(0, 0, 1), at(1, 0, 1), fx)
+		c11 := lerp(at(0, 1, 1), at(1, 1, 1), fx)
+		return lerp(lerp(c00, c10, fy), lerp(c01, c11, fy), fz)
+	}
+}
+
+func (s SDFBaked) Sphere() (Vec3, float64) {
+	return s.Center, s.Radius
+}
+
+func (s SDFBaked) Bounds() (Vec3, Vec3) {
+	return s.Min, s.Max
+}
+
+// Sample an expensive SDF3 tree onto a sparse grid with roughly
+// resolution cells across its bounding sphere.
+func Bake(resolution int, sdf SDF3) SDF3 {
+	center, radius := sdf.Sphere()
+	lo, hi := Bounds(sdf)
+	bricks := (resolution + bakeBrick - 1) / bakeBrick
+	if bricks < 1 {
+		bricks = 1
+	}
+	step := radius * 2 / float64(bricks*bakeBrick)
+
+	s := SDFBaked{
+		Center:  center,
+		Radius:  radius,
+		Min:     lo,
+		Max:     hi,
+		Origin:  center.Sub(V3(radius, radius, radius)),
+		Step:    step,
+		Bricks:  bricks,
+		Samples: map[int32][]float32{},
+		Inside:  make([]bool, bricks*bricks*bricks),
+	}
+
+	f := sdf.SDF()
+	band := float64(bakeBrick) * step
+	// from a brick's center to its farthest sample
+	reach := float64(bakeBrick) * step * math.Sqrt(3) / 2
+	const n = bakeBrick + 1
+
+	var mutex sync.Mutex
+
+	parallel(bricks, func(bz int) {
+		for by := 0; by < bricks; by++ {
+			for bx := 0; bx < bricks; bx++ {
+				id := bx + by*bricks + bz*bricks*bricks
+				corner := s.Origin.Add(V3(float64(bx), float64(by), float64(bz)).Scale(float64(bakeBrick) * step))
+				middle := corner.Add(V3(1, 1, 1).Scale(float64(bakeBrick) * step / 2))
+
+				// skip the dense sampling when the whole brick is clear
+				d := f(middle)
+				s.Inside[id] = d < 0
+				if abs(d) > reach+band {
+					continue
+				}
+
+				samples := make([]float32, n*n*n)
+				near := false
+				for z := 0; z < n; z++ {
+					for y := 0; y < n; y++ {
+						for x := 0; x < n; x++ {
+							d := f(corner.Add(V3(float64(x), float64(y), float64(z)).Scale(step)))
+							samples[x+y*n+z*n*n] = float32(d)
+							near = near || abs(d) <= band
+						}
+					}
+				}
+
+				if near {
+					mutex.Lock()
+					s.Samples[int32(id)] = samples
+					mutex.Unlock()
+				}
+			}
+		}
+	})
+
+	return s
+}
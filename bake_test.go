@@ -0,0 +1,62 @@
+package spt
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math/rand"
+	"testing"
+)
+
+func TestBake(t *testing.T) {
+	gear := GearWheel()
+	baked := Bake(128, gear)
+
+	want := gear.SDF()
+	got := baked.SDF()
+	step := baked.(SDFBaked).Step
+
+	if len(baked.(SDFBaked).Samples) >= 16*16*16 {
+		t.Errorf("baked grid is not sparse")
+	}
+
+	center, radius := gear.Sphere()
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		p := center.Add(pickVec3(rnd).Scale(radius * 1.5))
+		d, e := got(p), want(p)
+		// trilinear interpolation is close near the surface
+		if abs(e) < step && abs(d-e) > step {
+			t.Fatalf("baked at %v: %v != %v", p, d, e)
+		}
+		if (d < 0) != (e < 0) && abs(e) > step {
+			t.Fatalf("baked at %v: %v has the wrong sign for %v", p, d, e)
+		}
+	}
+
+	// away from the surface of an exact SDF the fallbacks never overshoot
+	exact := Union(Sphere(300), TranslateX(400, Cube(300, 300, 300)))
+	want = exact.SDF()
+	got = Bake(64, exact).SDF()
+	step = Bake(64, exact).(SDFBaked).Step
+	center, radius = exact.Sphere()
+	for i := 0; i < 5000; i++ {
+		p := center.Add(pickVec3(rnd).Scale(radius * 2))
+		if d, e := got(p), want(p); e > 0 && d > e+step {
+			t.Fatalf("baked at %v: %v overshoots %v", p, d, e)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	in := Object(Steel, baked)
+	if err := gob.NewEncoder(buf).Encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	var out Thing
+	if err := gob.NewDecoder(buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	p := V3(400, 30, 50)
+	if d, e := baked.SDF()(p), out.SDF3.SDF()(p); d != e {
+		t.Errorf("baked after gob: %v != %v", e, d)
+	}
+}
@@ -0,0 +1,233 @@
+package spt
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Bounding volume hierarchy over Scene.Stuff, built once per render.
+type thingTree struct {
+	nodes  []thingNode
+	lights []*Thing
+}
+
+type thingNode struct {
+	lo, hi      Vec3
+	left, right int    // children, or -1
+	thing       *Thing // leaves only
+}
+
+func newThingTree(stuff []Thing) *thingTree {
+	t := &thingTree{}
+	var things []*Thing
+	for i := range stuff {
+		thing := &stuff[i]
+		things = append(things, thing)
+		if _, is := thing.Material().Light(); is {
+			t.lights = append(t.lights, thing)
+		}
+	}
+	if len(things) > 0 {
+		t.build(things)
+	}
+	return t
+}
+
+// Both the sphere and the box bound the thing, so the overlap does too.
+func thingBox(t *Thing) (Vec3, Vec3) {
+	center, radius := t.Sphere()
+	r := V3(radius, radius, radius)
+	lo, hi := t.Bounds()
+	return max3(lo, center.Sub(r)), min3(hi, center.Add(r))
+}
+
+func (t *thingTree) build(things []*Thing) int {
+	mid := func(t *Thing) Vec3 {
+		lo, hi := thingBox(t)
+		return lo.Add(hi).Scale(0.5)
+	}
+
+	lo, hi := thingBox(things[0])
+	clo, chi := mid(things[0]), mid(things[0])
+	for _, thing := range things[1:] {
+		l, h := thingBox(thing)
+		lo, hi = min3(lo, l), max3(hi, h)
+		clo, chi = min3(clo, mid(thing)), max3(chi, mid(thing))
+	}
+
+	id := len(t.nodes)
+	t.nodes = append(t.nodes, thingNode{lo: lo, hi: hi, left: -1, right: -1})
+
+	if len(things) == 1 {
+		t.nodes[id].thing = things[0]
+		return id
+	}
+
+	// median split on the longest axis of the box centers
+	size := chi.Sub(clo)
+	axis := func(v Vec3) float64 { return v.X }
+	if size.Y > size.X && size.Y >= size.Z {
+		axis = func(v Vec3) float64 { return v.Y }
+	} else if size.Z > size.X && size.Z > size.Y {
+		axis = func(v Vec3) float64 { return v.Z }
+	}
+	sort.SliceStable(things, func(i, j int) bool {
+		return axis(mid(things[i])) < axis(mid(things[j]))
+	})
+
+	half := len(things) / 2
+	left := t.build(things[:half])
+	right := t.build(things[half:])
+	t.nodes[id].left = left
+	t.nodes[id].right = right
+	return id
+}
+
+// Does the ray pass through the box ahead of its origin? Takes the
+// reciprocal of the ray direction, as it's tested against many boxes.
+func (r Ray) hitsBox(lo, hi, inv Vec3, threshold float64) bool {
+	tmin, tmax := math.Inf(-1), math.Inf(1)
+	slab := func(o, d, l, h float64) bool {
+		if math.IsInf(d, 0) {
+			return o >= l && o <= h
+		}
+		t1 := (l - o) * d
+		t2 := (h - o) * d
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		if t1 > tmin {
+			tmin = t1
+		}
+		if t2 < tmax {
+			tmax = t2
+		}
+		return tmin <= tmax
+	}
+	return slab(r.Origin.X, inv.X, lo.X, hi.X) &&
+		slab(r.Origin.Y, inv.Y, lo.Y, hi.Y) &&
+		slab(r.Origin.Z, inv.Z, lo.Z, hi.Z) &&
+		tmax > threshold
+}
+
+// Does the ray pass through the thing's bounding sphere ahead of its
+// origin? Since objects have a bounding sphere, behave like a non-SDF
+// ray tracer and do a line-sphere intersection test to quickly rule
+// them in or out.
+func (r Ray) hitsSphere(t *Thing, threshold float64) bool {
+	center, radius := t.Sphere()
+	to := r.Origin.Sub(center)
+	b := to.Dot(r.Direction)
+	c := to.Dot(to) - radius*radius
+	d := b*b - c
+	if d > 0 {
+		d = sqrt(d)
+		return -b-d > threshold || -b+d > threshold
+	}
+	return false
+}
+
+// culled trees are short-lived and made for every ray, so recycle them
+var culled = sync.Pool{
+	New: func() interface{} {
+		return make([]thingNode, 0, 256)
+	},
+}
+
+// Copy the parts of the tree the ray passes through. The copy is what
+// the ray marches against, so objects it can't hit never slow it down.
+// Hand the result back to release() when done.
+func (t *thingTree) cull(r Ray, threshold float64) []thingNode {
+	if len(t.nodes) == 0 {
+		return nil
+	}
+	inv := V3(1/r.Direction.X, 1/r.Direction.Y, 1/r.Direction.Z)
+	nodes, _ := t.cullNode(r, inv, threshold, 0, culled.Get().([]thingNode)[:0])
+	return nodes
+}
+
+func (t *thingTree) release(nodes []thingNode) {
+	if nodes != nil {
+		culled.Put(nodes[:0])
+	}
+}
+
+func (t *thingTree) cullNode(r Ray, inv Vec3, threshold float64, n int, out []thingNode) ([]thingNode, int) {
+	node := &t.nodes[n]
+	if !r.hitsBox(node.lo, node.hi, inv, threshold) {
+		return out, -1
+	}
+
+	if node.thing != nil {
+		if !r.hitsSphere(node.thing, threshold) {
+			return out, -1
+		}
+		return append(out, *node), len(out)
+	}
+
+	id := len(out)
+	out = append(out, thingNode{lo: node.lo, hi: node.hi})
+
+	var left, right int
+	out, left = t.cullNode(r, inv, threshold, node.left, out)
+	out, right = t.cullNode(r, inv, threshold, node.right, out)
+
+	if left < 0 && right < 0 {
+		return out[:id], -1
+	}
+	out[id].left = left
+	out[id].right = right
+	return out, id
+}
+
+// Nearest thing to pos, pruning subtrees whose boxes are farther away
+// than the best distance so far.
+func nearestThing(nodes []thingNode, pos Vec3) (*Thing, float64) {
+	var stack [64]int
+	top := 0
+	stack[top] = 0
+	top++
+
+	near := (*Thing)(nil)
+	dist := 0.0
+
+	for top > 0 {
+		top--
+		node := &nodes[stack[top]]
+
+		if node.thing != nil {
+			t := node.thing
+			if near != nil && t.BoundingDistance(pos) > dist {
+				continue
+			}
+			if d := t.Distance(pos); d < dist || near == nil {
+				near = t
+				dist = d
+			}
+			continue
+		}
+
+		if near != nil && sqrt(boxDistance2(pos, node.lo, node.hi)) > dist {
+			continue
+		}
+
+		// visit the nearer child first, so push it last
+		l, r := node.left, node.right
+		if l >= 0 && r >= 0 {
+			if boxDistance2(pos, nodes[l].lo, nodes[l].hi) < boxDistance2(pos, nodes[r].lo, nodes[r].hi) {
+				l, r = r, l
+			}
+			stack[top], stack[top+1] = l, r
+			top += 2
+		} else if l >= 0 {
+			stack[top] = l
+			top++
+		} else {
+			stack[top] = r
+			top++
+		}
+	}
+
+	return near, dist
+}
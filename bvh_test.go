@@ -0,0 +1,95 @@
+package spt
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// a tray of 1000 fasteners
+func fastenerScene() Scene {
+	stuff := []Thing{
+		Object(
+			Light(White.Scale(4)),
+			Translate(V3(-7500, 0, 20000), Sphere(10000)),
+		),
+	}
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 25; y++ {
+			stuff = append(stuff, Object(Steel,
+				Translate(V3(float64(x)*300-6000, float64(y)*300-3750, 100),
+					Union(
+						Cylinder(200, 50),
+						TranslateZ(100, Extrude(40, Polygon(6, 90))),
+					),
+				),
+			))
+		}
+	}
+	return Scene{
+		Width:     64,
+		Height:    36,
+		Passes:    1,
+		Samples:   1,
+		Bounces:   4,
+		Horizon:   100000,
+		Threshold: 0.0001,
+		Ambient:   White.Scale(0.05),
+		Camera: NewCamera(
+			V3(0, -8000, 8000),
+			V3(0, 0, 0),
+			Z3,
+			40,
+			Zero3,
+			0.0,
+		),
+		Stuff: stuff,
+	}
+}
+
+func fastenerRays(scene Scene, n int) []Ray {
+	rnd := rand.New(rand.NewSource(1))
+	var rays []Ray
+	for i := 0; i < n; i++ {
+		x, y := rnd.Intn(scene.Width), rnd.Intn(scene.Height)
+		rays = append(rays, scene.Camera.CastRay(x, y, scene.Width, scene.Height, rnd.Float64(), rnd.Float64(), rnd))
+	}
+	return rays
+}
+
+func TestThingTree(t *testing.T) {
+	scene := fastenerScene()
+	scene.prepare()
+	linear := scene
+	linear.tree = nil
+
+	for _, r := range fastenerRays(scene, 500) {
+		a, pa := r.march(&scene, nil)
+		b, pb := r.march(&linear, nil)
+		if a != b || pa.Sub(pb).Length() > 1e-6 {
+			t.Fatalf("tree hit %p at %v, linear hit %p at %v", a, pa, b, pb)
+		}
+	}
+}
+
+func benchmarkMarch(b *testing.B, tree bool) {
+	scene := fastenerScene()
+	scene.prepare()
+	if !tree {
+		scene.tree = nil
+	}
+	rays := fastenerRays(scene, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, r := range rays {
+			r.march(&scene, nil)
+		}
+	}
+}
+
+func BenchmarkMarchLinear(b *testing.B) {
+	benchmarkMarch(b, false)
+}
+
+func BenchmarkMarchTree(b *testing.B) {
+	benchmarkMarch(b, true)
+}
@@ -0,0 +1,102 @@
+package spt
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+// prepared scenes an RPC worker keeps around
+const sceneCacheSize = 8
+
+var (
+	errSceneUnknown = errors.New("scene not cached")
+	errSceneHash    = errors.New("scene doesn't match its hash")
+)
+
+// The scene content workers cache: everything that's expensive to send
+// and prepare.
+type sceneStuff struct {
+	stuff []Thing
+	tree  *thingTree
+}
+
+// Gob-encode a scene's Stuff, and hash the encoding to name it. Gob
+// encodes maps in random order, so the same Stuff may hash differently
+// on a later call; that costs an upload, never a wrong answer.
+func encodeStuff(stuff []Thing) (string, []byte, error) {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(stuff); err != nil {
+		return "", nil, err
+	}
+	return hashStuff(buf.Bytes()), buf.Bytes(), nil
+}
+
+func hashStuff(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return hex.EncodeToString(sum[:])
+}
+
+func decodeStuff(blob []byte) (*sceneStuff, error) {
+	var stuff []Thing
+	if err := gob.NewDecoder(bytes.NewReader(blob)).Decode(&stuff); err != nil {
+		return nil, err
+	}
+	scene := Scene{Stuff: stuff}
+	scene.prepare()
+	return &sceneStuff{scene.Stuff, scene.tree}, nil
+}
+
+// Least recently used cache of prepared scenes, by hash.
+type sceneCache struct {
+	sync.Mutex
+	size    int
+	order   *list.List // front is most recent
+	entries map[string]*list.Element
+	uploads int
+}
+
+type sceneEntry struct {
+	hash  string
+	stuff *sceneStuff
+}
+
+func newSceneCache(size int) *sceneCache {
+	return &sceneCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *sceneCache) get(hash string) (*sceneStuff, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*sceneEntry).stuff, true
+}
+
+func (c *sceneCache) put(hash string, stuff *sceneStuff) {
+	c.Lock()
+	defer c.Unlock()
+	c.uploads++
+	if e, ok := c.entries[hash]; ok {
+		e.Value.(*sceneEntry).stuff = stuff
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[hash] = c.order.PushFront(&sceneEntry{hash, stuff})
+	for c.order.Len() > c.size {
+		old := c.order.Back()
+		c.order.Remove(old)
+		delete(c.entries, old.Value.(*sceneEntry).hash)
+	}
+}
@@ -0,0 +1,122 @@
+package spt
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSceneCache(t *testing.T) {
+	c := newSceneCache(2)
+	a, b, d := &sceneStuff{}, &sceneStuff{}, &sceneStuff{}
+	c.put("a", a)
+	c.put("b", b)
+	if s, ok := c.get("a"); !ok || s != a {
+		t.Fatalf("a missing")
+	}
+	// b is now the least recently used
+	c.put("d", d)
+	if _, ok := c.get("b"); ok {
+		t.Errorf("b survived eviction")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Errorf("a evicted")
+	}
+	if _, ok := c.get("d"); !ok {
+		t.Errorf("d evicted")
+	}
+}
+
+// a worker on a loopback port, counting connections
+func testWorker(t *testing.T, cache *sceneCache) (string, *int32, func()) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newRenderServer(cache)
+	var conns int32
+	go func() {
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			go server.ServeConn(conn)
+		}
+	}()
+	return listen.Addr().String(), &conns, func() { listen.Close() }
+}
+
+func TestRPCSceneCache(t *testing.T) {
+	cache := newSceneCache(sceneCacheSize)
+	addr, conns, stop := testWorker(t, cache)
+	defer stop()
+
+	renderer := NewRPCRenderer(addr)
+	defer renderer.(RPCRenderer).Close()
+
+	render := func() {
+		scene := tinyScene()
+		scene.Passes = 3
+		var last *Scene
+		for frame := range RenderContext(context.Background(), scene, []Renderer{renderer}, RenderOptions{
+			TileSize: 8,
+			Deadline: time.Now().Add(30 * time.Second),
+		}) {
+			last = frame.(*Scene)
+		}
+		if last == nil {
+			t.Fatal("no frames")
+		}
+		for i, p := range last.Raster {
+			if p.Rays != int32(scene.Passes*scene.Samples) {
+				t.Fatalf("pixel %d has %d rays", i, p.Rays)
+			}
+		}
+	}
+
+	// twelve tiles a pass, three passes, one connection and one upload
+	render()
+	if n := atomic.LoadInt32(conns); n != 1 {
+		t.Errorf("%d connections", n)
+	}
+	if cache.uploads != 1 {
+		t.Errorf("%d uploads", cache.uploads)
+	}
+
+	// a worker that forgets the scene gets it again
+	cache.Lock()
+	cache.order.Init()
+	cache.entries = map[string]*list.Element{}
+	cache.Unlock()
+	render()
+	if cache.uploads < 2 {
+		t.Errorf("scene not uploaded again after eviction")
+	}
+}
+
+// workers only cache scenes under their own hashes
+func TestRPCUploadHash(t *testing.T) {
+	cache := newSceneCache(sceneCacheSize)
+	srv := RenderRPC{cache}
+	_, blob, err := encodeStuff(tinyScene().Stuff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ok bool
+	for _, hash := range []string{"", "abc", hashStuff(nil)} {
+		if err := srv.Upload(SceneUpload{hash, blob}, &ok); err != errSceneHash {
+			t.Errorf("hash %q: %v", hash, err)
+		}
+	}
+	if cache.uploads != 0 {
+		t.Errorf("%d uploads cached", cache.uploads)
+	}
+	if err := srv.Upload(SceneUpload{hashStuff(blob), blob}, &ok); err != nil || !ok {
+		t.Errorf("upload failed: %v", err)
+	}
+}
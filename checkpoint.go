@@ -0,0 +1,151 @@
+package spt
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// A render's raw state: the scene with its summed Raster, and how many
+// passes of each seed went into it. Unlike an image it can be resumed,
+// or merged with checkpoints of the same scene rendered elsewhere.
+type Checkpoint struct {
+	Scene  Scene
+	Passes map[int64]int // passes 1 to n of each seed
+}
+
+// first bytes of a checkpoint file, and its version
+const checkpointMagic = "spt checkpoint 1\n"
+
+// Write a checkpoint, gob-encoded and gzipped.
+func WriteCheckpoint(w io.Writer, c *Checkpoint) error {
+	if _, err := io.WriteString(w, checkpointMagic); err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	if err := gob.NewEncoder(zw).Encode(c); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(checkpointMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != checkpointMagic {
+		return nil, errors.New("not a checkpoint")
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	c := new(Checkpoint)
+	if err := gob.NewDecoder(zr).Decode(c); err != nil {
+		return nil, err
+	}
+	if len(c.Scene.Raster) != c.Scene.Width*c.Scene.Height {
+		return nil, fmt.Errorf("%d pixels for a %dx%d image", len(c.Scene.Raster), c.Scene.Width, c.Scene.Height)
+	}
+	return c, nil
+}
+
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	c, err := ReadCheckpoint(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Save a checkpoint beside the old one and swap, so a crash while saving
+// leaves the old one whole.
+func SaveCheckpoint(path string, c *Checkpoint) error {
+	buf := new(bytes.Buffer)
+	if err := WriteCheckpoint(buf, c); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path))
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Carry on rendering where a checkpoint left off, as RenderContext
+// would, from the pass after the last one of Scene.Seed it holds; frames
+// include everything in the checkpoint. Scene.Passes counts that seed's
+// passes, so raise it to render more than was first asked for. Merged
+// checkpoints have no seed, so carry on with a new one. Non-adaptive
+// renders resume exactly as if never stopped.
+func (c *Checkpoint) Resume(ctx context.Context, renderers []Renderer, opts RenderOptions) chan image.Image {
+	return renderFrom(ctx, c.Scene, renderers, opts, c)
+}
+
+// Merge checkpoints of the same scene into one, as if a single render
+// had taken all their samples. Each seed may only appear once, as the
+// same seed's passes repeat the same samples.
+func MergeCheckpoints(cs ...*Checkpoint) (*Checkpoint, error) {
+	if len(cs) == 0 {
+		return nil, errors.New("no checkpoints")
+	}
+	merged := &Checkpoint{Scene: cs[0].Scene, Passes: map[int64]int{}}
+	merged.Scene.Seed = 0
+	merged.Scene.Raster = make(Raster, len(cs[0].Scene.Raster))
+	for i, c := range cs {
+		if err := sameScene(c.Scene, merged.Scene); err != nil {
+			return nil, fmt.Errorf("checkpoint %d: %v", i+1, err)
+		}
+		for seed, passes := range c.Passes {
+			if _, ok := merged.Passes[seed]; ok {
+				return nil, fmt.Errorf("checkpoint %d repeats seed %d", i+1, seed)
+			}
+			merged.Passes[seed] = passes
+		}
+		merged.Scene.Merge(c.Scene.Raster)
+	}
+	return merged, nil
+}
+
+// Whether two checkpoints' samples can be summed: the same scene file,
+// give or take how they were sampled and displayed. Scenes that can't be
+// written to a file can't be compared, so can't be merged.
+func sameScene(a, b Scene) error {
+	if a.Width != b.Width || a.Height != b.Height {
+		return fmt.Errorf("%dx%d, not %dx%d", a.Width, a.Height, b.Width, b.Height)
+	}
+	encode := func(s Scene) ([]byte, error) {
+		s.Seed, s.Passes, s.Samples = 0, 0, 0
+		s.Adaptive, s.Noise, s.Sampler = false, 0, nil
+		s.Display = Display{}
+		buf := new(bytes.Buffer)
+		err := WriteScene(buf, s, SceneYAML)
+		return buf.Bytes(), err
+	}
+	ea, err := encode(a)
+	if err != nil {
+		return fmt.Errorf("can't compare scenes: %v", err)
+	}
+	eb, err := encode(b)
+	if err != nil {
+		return fmt.Errorf("can't compare scenes: %v", err)
+	}
+	if !bytes.Equal(ea, eb) {
+		return errors.New("a different scene")
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package spt
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func checkpointFrames(t *testing.T, frames chan image.Image) *Scene {
+	var last *Scene
+	for frame := range frames {
+		last = frame.(*Scene)
+	}
+	if last == nil {
+		t.Fatal("no frames")
+	}
+	return last
+}
+
+func TestCheckpointFile(t *testing.T) {
+	scene := tinyScene()
+	scene.Seed = 3
+	scene.Filter, scene.Sampler = Tent{}, Sobol{}
+	scene.Display.Tone = ACES{}
+	scene.Raster = scene.Render()
+	c := &Checkpoint{Scene: scene, Passes: map[int64]int{3: 1}}
+
+	buf := new(bytes.Buffer)
+	if err := WriteCheckpoint(buf, c); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadCheckpoint(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Passes[3] != 1 || got.Scene.Seed != 3 || got.Scene.Filter != (Tent{}) || got.Scene.Sampler != (Sobol{}) || got.Scene.Display.Tone != (ACES{}) {
+		t.Errorf("read %+v", got)
+	}
+	for i := range scene.Raster {
+		if got.Scene.Raster[i] != scene.Raster[i] {
+			t.Fatalf("pixel %d: %+v, read %+v", i, scene.Raster[i], got.Scene.Raster[i])
+		}
+	}
+
+	for _, data := range []string{"", "spt checkpoint 1\n", "P6\n32 18\n255\n"} {
+		if _, err := ReadCheckpoint(strings.NewReader(data)); err == nil {
+			t.Errorf("read %q", data)
+		}
+	}
+}
+
+// a render stopped and resumed from its checkpoint ends the same as one
+// that never stopped
+func TestCheckpointResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tiny.ckpt")
+
+	scene := tinyScene()
+	scene.Passes, scene.Samples = 4, 2
+	scene.Seed = 5
+	scene.Filter = Mitchell{}
+	opts := RenderOptions{TileSize: 8, Deadline: time.Now().Add(30 * time.Second)}
+	whole := checkpointFrames(t, RenderContext(context.Background(), scene, nil, opts))
+
+	// every merge saved, and the last at the end
+	half := scene
+	half.Passes = 2
+	opts.Checkpoint, opts.CheckpointEvery = path, time.Nanosecond
+	checkpointFrames(t, RenderContext(context.Background(), half, nil, opts))
+	c, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Passes[5] != 2 || len(c.Passes) != 1 {
+		t.Fatalf("checkpoint of passes %v", c.Passes)
+	}
+
+	c.Scene.Passes = 4
+	frames := 0
+	var resumed *Scene
+	for frame := range c.Resume(context.Background(), nil, opts) {
+		resumed = frame.(*Scene)
+		frames++
+	}
+	if frames != 2 {
+		t.Fatalf("%d frames resumed", frames)
+	}
+	for i := range whole.Raster {
+		if whole.Raster[i] != resumed.Raster[i] {
+			t.Fatalf("pixel %d: %+v, resumed %+v", i, whole.Raster[i], resumed.Raster[i])
+		}
+	}
+	if c, err = LoadCheckpoint(path); err != nil || c.Passes[5] != 4 {
+		t.Fatalf("checkpoint of passes %v, %v", c.Passes, err)
+	}
+
+	// adaptive renders resume too, planning from the checkpoint
+	adaptive := half
+	adaptive.Samples, adaptive.Adaptive = 4, true
+	checkpointFrames(t, RenderContext(context.Background(), adaptive, nil, opts))
+	if c, err = LoadCheckpoint(path); err != nil {
+		t.Fatal(err)
+	}
+	c.Scene.Passes = 4
+	last := checkpointFrames(t, c.Resume(context.Background(), nil, opts))
+	if rays := last.Raster[0].Rays; rays == 0 {
+		t.Errorf("pixel 0 has no rays")
+	}
+}
+
+func TestCheckpointMerge(t *testing.T) {
+	checkpoint := func(seed int64, passes int) *Checkpoint {
+		scene := tinyScene()
+		scene.Passes, scene.Seed = passes, seed
+		last := checkpointFrames(t, RenderContext(context.Background(), scene, nil, RenderOptions{Deadline: time.Now().Add(30 * time.Second)}))
+		return &Checkpoint{Scene: *last, Passes: map[int64]int{seed: passes}}
+	}
+	a, b := checkpoint(1, 2), checkpoint(2, 1)
+	merged, err := MergeCheckpoints(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Scene.Seed != 0 || merged.Passes[1] != 2 || merged.Passes[2] != 1 {
+		t.Errorf("merged seed %d, passes %v", merged.Scene.Seed, merged.Passes)
+	}
+	for i, p := range merged.Scene.Raster {
+		if p.Rays != a.Scene.Raster[i].Rays+b.Scene.Raster[i].Rays {
+			t.Fatalf("pixel %d: %d rays from %d and %d", i, p.Rays, a.Scene.Raster[i].Rays, b.Scene.Raster[i].Rays)
+		}
+	}
+
+	// carried on with a seed of its own
+	merged.Scene.Passes = 1
+	last := checkpointFrames(t, merged.Resume(context.Background(), nil, RenderOptions{Deadline: time.Now().Add(30 * time.Second)}))
+	if last.Raster[0].Rays != merged.Scene.Raster[0].Rays+1 {
+		t.Errorf("resumed pixel 0 has %d rays, merged %d", last.Raster[0].Rays, merged.Scene.Raster[0].Rays)
+	}
+
+	if _, err := MergeCheckpoints(a, checkpoint(1, 1)); err == nil {
+		t.Error("merged a seed twice")
+	}
+	other := checkpoint(3, 1)
+	other.Scene.Stuff = other.Scene.Stuff[:1]
+	if _, err := MergeCheckpoints(a, other); err == nil {
+		t.Error("merged different scenes")
+	}
+	other = checkpoint(3, 1)
+	other.Scene.Width, other.Scene.Height = other.Scene.Height, other.Scene.Width
+	if _, err := MergeCheckpoints(a, other); err == nil {
+		t.Error("merged different sizes")
+	}
+	other = checkpoint(3, 1)
+	other.Scene.Filter = Tent{}
+	if _, err := MergeCheckpoints(a, other); err == nil {
+		t.Error("merged different filters")
+	}
+
+	// scenes that can't be compared aren't merged
+	other = checkpoint(3, 1)
+	a.Scene.Stuff = append([]Thing{Object(Steel, unsavedSDF{Sphere(1)})}, a.Scene.Stuff[1:]...)
+	other.Scene.Stuff = append([]Thing{Object(Steel, unsavedSDF{Cube(1, 1, 1)})}, other.Scene.Stuff[1:]...)
+	if _, err := MergeCheckpoints(a, other); err == nil || !strings.Contains(err.Error(), "can't compare") {
+		t.Errorf("merged scenes that can't be saved: %v", err)
+	}
+}
+
+// a shape scene files don't know
+type unsavedSDF struct {
+	SDF3
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/seanpringle/spt"
+	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -15,8 +16,19 @@ func main() {
 
 	port := flag.Int("p", 34242, "TCP port")
 	prof := flag.Int("prof", 0, "pprof port")
+	join := flag.String("join", "", "farm coordinator host:port to join")
+	web := flag.String("http", "", "HTTP address to accept render jobs on, rendered locally, such as localhost:8080; TLS and -token apply")
+	cert := flag.String("cert", "", "TLS certificate PEM file")
+	key := flag.String("key", "", "TLS private key PEM file")
+	ca := flag.String("ca", "", "CA PEM file; clients and the coordinator must have certificates signed by it")
+	token := flag.String("token", os.Getenv("SPT_TOKEN"), "shared token clients must present (default $SPT_TOKEN)")
 	flag.Parse()
 
+	serve, dial, err := spt.Transports(*cert, *key, *ca, *token)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	if *prof > 0 {
 		go http.ListenAndServe(fmt.Sprintf(":%d", *prof), nil)
 	}
@@ -24,16 +36,13 @@ func main() {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
-	sem := make(chan struct{}, 1)
 	stop := make(chan struct{})
-
-	sem <- struct{}{}
 	go func() {
-		spt.RenderServeRPC(stop, *port)
-		<-sem
+		<-sigs
+		close(stop)
 	}()
 
-	<-sigs
-	close(stop)
-	sem <- struct{}{}
+	if err := spt.RenderWorker(stop, *port, *web, *join, serve, dial); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"github.com/seanpringle/spt"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// edge of the probe render used to estimate cost
+const probeWidth = 64
+
+func info(args []string) error {
+	fs := flags("info", "scene.yaml")
+	probe := fs.Bool("probe", true, "time a small render to estimate the full one")
+	fs.Parse(args)
+
+	path, scene, err := sceneArg(fs)
+	if err != nil {
+		return err
+	}
+
+	passes := fmt.Sprint(scene.Passes)
+	if scene.Passes == 0 {
+		passes = "unlimited"
+	}
+	fmt.Printf("%s: %dx%d, %s passes of %d samples, %d bounces\n",
+		path, scene.Width, scene.Height, passes, scene.Samples, scene.Bounces)
+
+	fmt.Printf("%d things\n", len(scene.Stuff))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\t#\tmaterial\tshape\tcenter\tradius")
+	shapes := make([]spt.SDF3, len(scene.Stuff))
+	for i, thing := range scene.Stuff {
+		shapes[i] = thing.SDF3
+		center, radius := thing.SDF3.Sphere()
+		fmt.Fprintf(tw, "\t%d\t%s\t%s\t%s\t%g\n", i, typeName(thing.Mat), typeName(thing.SDF3), vec(center), radius)
+	}
+	tw.Flush()
+	center, radius := spt.Union(shapes...).Sphere()
+	fmt.Printf("bounding sphere %s, radius %g\n", vec(center), radius)
+
+	rays := scene.Width * scene.Height * scene.Samples
+	fmt.Printf("%d camera rays per pass", rays)
+	if scene.Passes > 0 {
+		fmt.Printf(", %d in all", rays*scene.Passes)
+	}
+	fmt.Println()
+	if !*probe || rays == 0 {
+		return nil
+	}
+
+	// a single sample per pixel of a small copy, to extrapolate from
+	small := scene
+	small.Width = probeWidth
+	small.Height = (probeWidth*scene.Height + scene.Width - 1) / scene.Width
+	small.Samples = 1
+	small.Budget = nil
+	start := time.Now()
+	small.Render()
+	took := time.Since(start)
+
+	perPass := time.Duration(float64(took) * float64(rays) / float64(small.Width*small.Height))
+	fmt.Printf("estimated %s per pass on %d cores", roughly(perPass), runtime.NumCPU())
+	if scene.Passes > 0 {
+		fmt.Printf(", %s in all", roughly(perPass*time.Duration(scene.Passes)))
+	}
+	fmt.Println()
+	return nil
+}
+
+func roughly(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
+
+// a value's type as a scene file names it
+func typeName(v interface{}) string {
+	name := fmt.Sprintf("%T", v)
+	name = strings.TrimPrefix(name, "spt.")
+	name = strings.TrimPrefix(name, "SDF")
+	if name == "" {
+		return "?"
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func vec(v spt.Vec3) string {
+	return fmt.Sprintf("[%g, %g, %g]", v.X, v.Y, v.Z)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/seanpringle/spt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultPort = 34242
+
+var commands = []struct {
+	name, usage string
+	run         func(args []string) error
+}{
+	{"render", "render a scene file to an image", render},
+	{"serve", "serve renders over RPC, like rpc-server", serve},
+	{"mesh", "export a scene's geometry as STL or OBJ", mesh},
+	{"info", "describe a scene and estimate its cost", info},
+	{"merge", "merge checkpoints rendered apart into one", merge},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: spt <command> [flags] [scene]")
+	fmt.Fprintln(os.Stderr)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run spt <command> -h for a command's flags.")
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "spt "+c.name+":", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	if name := os.Args[1]; name != "-h" && name != "-help" && name != "help" {
+		fmt.Fprintf(os.Stderr, "spt: unknown command %q\n\n", name)
+	}
+	usage()
+	os.Exit(2)
+}
+
+func flags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet("spt "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: spt %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// the one scene file a command was given
+func sceneArg(fs *flag.FlagSet) (string, spt.Scene, error) {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	scene, err := spt.LoadScene(path)
+	return path, scene, err
+}
+
+// replace path's extension with ext
+func beside(path, ext string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+// TLS and token flags, shared by anything that talks to workers
+type transportFlags struct {
+	cert, key, ca, token *string
+}
+
+func addTransportFlags(fs *flag.FlagSet) transportFlags {
+	return transportFlags{
+		cert:  fs.String("cert", "", "TLS certificate PEM file"),
+		key:   fs.String("key", "", "TLS private key PEM file"),
+		ca:    fs.String("ca", "", "CA PEM file; peers must have certificates signed by it"),
+		token: fs.String("token", os.Getenv("SPT_TOKEN"), "shared token for workers (default $SPT_TOKEN)"),
+	}
+}
+
+// transports for accepting connections, and for dialling out
+func (f transportFlags) transports() (serve, dial spt.Transport, err error) {
+	return spt.Transports(*f.cert, *f.key, *f.ca, *f.token)
+}
+
+// Renderers for a -workers list, where "local" is this machine and
+// anything else a worker's host, with or without a port.
+func workers(list string, transport spt.Transport) []spt.Renderer {
+	var renderers []spt.Renderer
+	for _, w := range strings.Split(list, ",") {
+		switch w = strings.TrimSpace(w); {
+		case w == "":
+		case w == "local":
+			renderers = append(renderers, spt.NewLocalRenderer())
+		default:
+			if _, _, err := net.SplitHostPort(w); err != nil {
+				w = net.JoinHostPort(w, fmt.Sprint(defaultPort))
+			}
+			renderers = append(renderers, spt.NewRPCRendererWith(w, transport))
+		}
+	}
+	return renderers
+}
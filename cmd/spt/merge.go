@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"github.com/seanpringle/spt"
+	"log"
+	"os"
+)
+
+func merge(args []string) error {
+	fs := flags("merge", "a.ckpt b.ckpt...")
+	out := fs.String("o", "merged.ckpt", "output checkpoint, or an image: .png, .exr, .pfm or .hdr")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var cs []*spt.Checkpoint
+	for _, path := range fs.Args() {
+		c, err := spt.LoadCheckpoint(path)
+		if err != nil {
+			return err
+		}
+		cs = append(cs, c)
+	}
+	merged, err := spt.MergeCheckpoints(cs...)
+	if err != nil {
+		return err
+	}
+
+	passes := 0
+	for _, n := range merged.Passes {
+		passes += n
+	}
+	log.Println("merged", passes, "passes from", len(merged.Passes), "seeds")
+	if isCheckpoint(*out) {
+		err = spt.SaveCheckpoint(*out, merged)
+	} else {
+		err = saveImage(&merged.Scene, *out)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", *out, err)
+	}
+	log.Println("saved", *out)
+	return nil
+}
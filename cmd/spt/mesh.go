@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"github.com/seanpringle/spt"
+	"log"
+)
+
+func mesh(args []string) error {
+	fs := flags("mesh", "scene.yaml")
+	out := fs.String("o", "", "output mesh, .stl or .obj (default the scene's name with .stl)")
+	resolution := fs.Int("res", 128, "grid cells across the bounding sphere of the scene")
+	dual := fs.Bool("dual", false, "dual contouring, keeping sharp edges, instead of marching cubes")
+	lights := fs.Bool("lights", false, "include lights and shadow-only things")
+	fs.Parse(args)
+
+	path, scene, err := sceneArg(fs)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = beside(path, ".stl")
+	}
+
+	var shapes []spt.SDF3
+	for _, thing := range scene.Stuff {
+		if !*lights && !solid(thing.Mat) {
+			continue
+		}
+		shapes = append(shapes, thing.SDF3)
+	}
+	if len(shapes) == 0 {
+		return fmt.Errorf("%s: nothing solid to mesh", path)
+	}
+
+	sdf := shapes[0]
+	if len(shapes) > 1 {
+		sdf = spt.Union(shapes...)
+	}
+
+	var m spt.Mesh
+	if *dual {
+		m = spt.DualContour(sdf, *resolution)
+	} else {
+		m = spt.MarchingCubes(sdf, *resolution)
+	}
+	if err := spt.SaveMesh(m, *out); err != nil {
+		return err
+	}
+	log.Println("saved", *out, len(m.Facets), "facets")
+	return nil
+}
+
+// whether a material is something you could print
+func solid(mat spt.Material) bool {
+	if _, ok := mat.Light(); ok {
+		return false
+	}
+	switch mat.(type) {
+	case spt.Invisible, spt.Nothing:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/seanpringle/spt"
+	"image"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func render(args []string) error {
+	fs := flags("render", "scene.yaml|render.ckpt")
+	out := fs.String("o", "", "output image, .png, .exr, .pfm or .hdr (default the scene's name with .png)")
+	width := fs.Int("width", 0, "image width, keeping the aspect ratio unless -height is given too")
+	height := fs.Int("height", 0, "image height, keeping the aspect ratio unless -width is given too")
+	passes := fs.Int("passes", 0, "render passes, 0 for unlimited")
+	samples := fs.Int("samples", 0, "samples per pixel per pass")
+	seed := fs.Int64("seed", 0, "random seed")
+	exposure := fs.Float64("exposure", 0, "exposure in stops, for PNGs")
+	tone := fs.String("tone", "", "tone map for PNGs: clip, reinhard, aces or hable")
+	filter := fs.String("filter", "", "reconstruction filter: box, tent, gaussian, mitchell or lanczos")
+	sampler := fs.String("sampler", "", "sample numbers: random, stratified, sobol or blueNoise")
+	list := fs.String("workers", "local", "comma-separated renderers: local, or a worker's host[:port]")
+	farm := fs.Int("farm", 0, "port to accept farm workers on, as well as -workers")
+	tile := fs.Int("tile", 0, "tile edge in pixels")
+	timeout := fs.Duration("timeout", 0, "stop after this long, keeping the image so far")
+	denoise := fs.Bool("denoise", false, "denoise every frame, guided by the AOVs")
+	checkpoint := fs.String("checkpoint", "", "keep the raw render in this file, to resume or merge (default the checkpoint resumed)")
+	every := fs.Duration("checkpoint-every", time.Minute, "time between checkpoints")
+	aov := fs.Bool("aov", false, "also save depth, normal, albedo and ID layers: in the image if EXR, otherwise beside it")
+	tf := addTransportFlags(fs)
+	fs.Parse(args)
+
+	path, scene, resume, err := renderArg(fs)
+	if err != nil {
+		return err
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if resume != nil && (set["width"] || set["height"]) {
+		return fmt.Errorf("can't resize a checkpoint")
+	}
+	switch {
+	case set["width"] && set["height"]:
+		scene.Width, scene.Height = *width, *height
+	case set["width"]:
+		scene.Width, scene.Height = *width, *width*scene.Height/scene.Width
+	case set["height"]:
+		scene.Width, scene.Height = *height*scene.Width/scene.Height, *height
+	}
+	if scene.Width <= 0 || scene.Height <= 0 {
+		return fmt.Errorf("image size %dx%d", scene.Width, scene.Height)
+	}
+	if set["passes"] {
+		scene.Passes = *passes
+	}
+	if set["samples"] {
+		scene.Samples = *samples
+	}
+	if set["seed"] {
+		scene.Seed = *seed
+	}
+	if *aov {
+		scene.AOV = true
+	}
+	if set["exposure"] {
+		scene.Display.Exposure = *exposure
+	}
+	if set["tone"] {
+		switch *tone {
+		case "clip":
+			scene.Display.Tone = spt.Clip{}
+		case "reinhard":
+			scene.Display.Tone = spt.Reinhard{}
+		case "aces":
+			scene.Display.Tone = spt.ACES{}
+		case "hable":
+			scene.Display.Tone = spt.Hable{}
+		default:
+			return fmt.Errorf("unknown tone map %q", *tone)
+		}
+	}
+	if set["filter"] {
+		switch *filter {
+		case "box":
+			scene.Filter = spt.Box{}
+		case "tent":
+			scene.Filter = spt.Tent{}
+		case "gaussian":
+			scene.Filter = spt.Gaussian{}
+		case "mitchell":
+			scene.Filter = spt.Mitchell{}
+		case "lanczos":
+			scene.Filter = spt.Lanczos{}
+		default:
+			return fmt.Errorf("unknown filter %q", *filter)
+		}
+	}
+	if set["sampler"] {
+		switch *sampler {
+		case "random":
+			scene.Sampler = nil
+		case "stratified":
+			scene.Sampler = spt.Stratified{}
+		case "sobol":
+			scene.Sampler = spt.Sobol{}
+		case "blueNoise":
+			scene.Sampler = spt.BlueNoise{}
+		default:
+			return fmt.Errorf("unknown sampler %q", *sampler)
+		}
+	}
+
+	if resume != nil {
+		if done := resume.Passes[scene.Seed]; scene.Passes > 0 && done >= scene.Passes {
+			return fmt.Errorf("%d of %d passes already rendered; raise -passes to carry on", done, scene.Passes)
+		}
+		resume.Scene = scene
+		if *checkpoint == "" {
+			*checkpoint = path
+		}
+	}
+
+	if *out == "" {
+		*out = beside(path, ".png")
+	}
+	// fail now rather than after the first pass
+	switch strings.ToLower(filepath.Ext(*out)) {
+	case ".png", ".exr", ".pfm", ".hdr":
+	default:
+		return fmt.Errorf("unknown image format: %s", *out)
+	}
+
+	serveT, dialT, err := tf.transports()
+	if err != nil {
+		return err
+	}
+	opts := spt.RenderOptions{TileSize: *tile, Checkpoint: *checkpoint, CheckpointEvery: *every}
+	if *denoise {
+		opts.Denoise = &spt.Denoiser{}
+	}
+	if *timeout > 0 {
+		opts.Deadline = time.Now().Add(*timeout)
+	}
+
+	renderers := workers(*list, dialT)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if *farm > 0 {
+		opts.Farm = spt.NewFarm()
+		opts.Farm.Transport = serveT
+		go opts.Farm.Serve(stop, *farm)
+	}
+	if len(renderers) == 0 && opts.Farm == nil {
+		return fmt.Errorf("no workers")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Println("stopping; the image so far is kept")
+		cancel()
+	}()
+
+	var frames chan image.Image
+	if resume != nil {
+		frames = resume.Resume(ctx, renderers, opts)
+	} else {
+		frames = spt.RenderContext(ctx, scene, renderers, opts)
+	}
+	var last *spt.Scene
+	for frame := range frames {
+		if last == nil && scene.Seed == 0 {
+			log.Println("seed", frame.(*spt.Scene).Seed)
+		}
+		if err := saveImage(frame, *out); err != nil {
+			return err
+		}
+		last = frame.(*spt.Scene)
+	}
+	if last == nil {
+		return fmt.Errorf("stopped before the first pass")
+	}
+	log.Println("saved", *out)
+	if *checkpoint != "" {
+		log.Println("saved", *checkpoint)
+	}
+	if scene.AOV {
+		return saveLayers(last, *out)
+	}
+	return nil
+}
+
+// the scene file to render, or a checkpoint to resume
+func renderArg(fs *flag.FlagSet) (string, spt.Scene, *spt.Checkpoint, error) {
+	if fs.NArg() == 1 && isCheckpoint(fs.Arg(0)) {
+		c, err := spt.LoadCheckpoint(fs.Arg(0))
+		if err != nil {
+			return "", spt.Scene{}, nil, err
+		}
+		return fs.Arg(0), c.Scene, c, nil
+	}
+	path, scene, err := sceneArg(fs)
+	return path, scene, nil, err
+}
+
+func isCheckpoint(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".ckpt"
+}
+
+// AOVs as layers of an EXR, or as images named for them beside the
+// others
+func saveLayers(scene *spt.Scene, out string) error {
+	ext := filepath.Ext(out)
+	if strings.ToLower(ext) == ".exr" {
+		file, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		err = spt.WriteLayers(file, scene)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	for _, name := range spt.Layers {
+		img, err := scene.Layer(name)
+		if err != nil {
+			return err
+		}
+		path := beside(out, "."+name+ext)
+		if err := spt.SaveImage(img, path); err != nil {
+			return err
+		}
+		log.Println("saved", path)
+	}
+	return nil
+}
+
+// write beside the old image and swap, so viewers never see half a file
+func saveImage(img image.Image, path string) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path))
+	if err := spt.SaveImage(img, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
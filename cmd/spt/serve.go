@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"github.com/seanpringle/spt"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func serve(args []string) error {
+	fs := flags("serve", "")
+	port := fs.Int("p", defaultPort, "TCP port")
+	prof := fs.Int("prof", 0, "pprof port")
+	join := fs.String("join", "", "farm coordinator host:port to join")
+	web := fs.String("http", "", "HTTP address to accept render jobs on, rendered locally, such as localhost:8080; TLS and -token apply")
+	tf := addTransportFlags(fs)
+	fs.Parse(args)
+
+	serveT, dialT, err := tf.transports()
+	if err != nil {
+		return err
+	}
+
+	if *prof > 0 {
+		go http.ListenAndServe(fmt.Sprintf(":%d", *prof), nil)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	stop := make(chan struct{})
+	go func() {
+		<-sigs
+		close(stop)
+	}()
+
+	return spt.RenderWorker(stop, *port, *web, *join, serveT, dialT)
+}
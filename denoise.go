@@ -0,0 +1,174 @@
+package spt
+
+import (
+	"math"
+)
+
+// An edge-avoiding à-trous wavelet filter, after Dammertz et al. and
+// SVGF. Lighting is separated from first-hit albedo, blurred over
+// widening 5x5 footprints where normals, depth and albedo agree and
+// brightness differs by no more than its noise, then multiplied back.
+// Needs a scene rendered with AOV set; without it only brightness
+// guides the filter. The zero value uses the defaults.
+type Denoiser struct {
+	Iterations int     // footprint doublings, 5 by default
+	Color      float64 // brightness differences allowed, in standard errors, 4 by default
+	Normal     float64 // power of the normals' dot product, 64 by default
+	Depth      float64 // depth differences allowed, relative to depth, 0.05 by default
+	Albedo     float64 // albedo differences allowed, 0.1 by default
+}
+
+// B3 spline
+var atrousKernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+type texel struct {
+	light    Color   // color over albedo
+	variance float64 // of light's brightness
+	albedo   Color
+	normal   Vec3
+	depth    float64
+	hit      bool
+}
+
+func (d Denoiser) defaults() Denoiser {
+	if d.Iterations <= 0 {
+		d.Iterations = 5
+	}
+	if d.Color <= 0 {
+		d.Color = 4
+	}
+	if d.Normal <= 0 {
+		d.Normal = 64
+	}
+	if d.Depth <= 0 {
+		d.Depth = 0.05
+	}
+	if d.Albedo <= 0 {
+		d.Albedo = 0.1
+	}
+	return d
+}
+
+// A copy of the scene with its raster denoised. AOVs, alpha and ray
+// counts are kept, so it can be saved, or denoised again after more
+// passes are merged into the original.
+func (d Denoiser) Denoise(scene *Scene) *Scene {
+	d = d.defaults()
+	width, height := scene.Width, scene.Height
+
+	texels := make([]texel, len(scene.Raster))
+	for i := range scene.Raster {
+		p := &scene.Raster[i]
+		t := &texels[i]
+		t.albedo = White
+		if p.Rays == 0 {
+			continue
+		}
+		n := float64(p.Rays)
+		c := p.mean()
+		if p.Hits > 0 {
+			hits := float64(p.Hits)
+			t.hit = true
+			t.albedo = p.Albedo.Scale(1 / hits).Add(Color{0.01, 0.01, 0.01})
+			t.normal = p.Normal.Unit()
+			t.depth = p.Depth / hits
+		}
+		t.light = c.Div(t.albedo)
+		// the standard error of the mean, scaled like the light
+		_, variance := p.spread()
+		variance /= n
+		a := t.albedo.Brightness()
+		t.variance = variance / (a * a)
+	}
+
+	// a pixel's own variance needs a few rays to be trusted, so until
+	// then look to its neighbours, among the things they hit
+	estimate := make([]float64, len(texels))
+	parallel(height, func(y int) {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			if scene.Raster[i].Rays >= adaptiveMinRays {
+				estimate[i] = texels[i].variance
+				continue
+			}
+			var sum, square, n float64
+			for ty := y - 2; ty <= y+2; ty++ {
+				for tx := x - 2; tx <= x+2; tx++ {
+					if tx >= 0 && tx < width && ty >= 0 && ty < height && texels[ty*width+tx].hit == texels[i].hit {
+						l := texels[ty*width+tx].light.Brightness()
+						sum += l
+						square += l * l
+						n++
+					}
+				}
+			}
+			mean := sum / n
+			estimate[i] = max(texels[i].variance, square/n-mean*mean)
+		}
+	})
+	for i := range texels {
+		texels[i].variance = estimate[i]
+	}
+
+	next := make([]texel, len(texels))
+	for i := 0; i < d.Iterations; i++ {
+		step := 1 << uint(i)
+		parallel(height, func(y int) {
+			for x := 0; x < width; x++ {
+				next[y*width+x] = d.filter(texels, width, height, x, y, step)
+			}
+		})
+		texels, next = next, texels
+	}
+
+	out := *scene
+	out.Raster = make(Raster, len(scene.Raster))
+	for i, p := range scene.Raster {
+		t := &texels[i]
+		p.Color = t.light.Mul(t.albedo).Scale(p.weight())
+		out.Raster[i] = p
+	}
+	return &out
+}
+
+func (d Denoiser) filter(texels []texel, width, height, x, y, step int) texel {
+	center := texels[y*width+x]
+	lum := center.light.Brightness()
+	sigma := d.Color*math.Sqrt(center.variance) + 1e-6
+
+	var sum Color
+	var variance, total float64
+	for dy := -2; dy <= 2; dy++ {
+		ty := y + dy*step
+		if ty < 0 || ty >= height {
+			continue
+		}
+		for dx := -2; dx <= 2; dx++ {
+			tx := x + dx*step
+			if tx < 0 || tx >= width {
+				continue
+			}
+			t := &texels[ty*width+tx]
+			if t.hit != center.hit {
+				continue
+			}
+			e := math.Abs(t.light.Brightness()-lum) / sigma
+			w := atrousKernel[dx+2] * atrousKernel[dy+2]
+			if center.hit {
+				a := t.albedo.Add(center.albedo.Scale(-1))
+				e += (a.R*a.R + a.G*a.G + a.B*a.B) / (d.Albedo * d.Albedo)
+				e += math.Abs(t.depth-center.depth) / (d.Depth*center.depth*float64(step) + 1e-9)
+				w *= math.Pow(max(0, t.normal.Dot(center.normal)), d.Normal)
+			}
+			w *= math.Exp(-e)
+			sum = sum.Add(t.light.Scale(w))
+			variance += w * w * t.variance
+			total += w
+		}
+	}
+
+	// the center always counts fully, so total is never zero
+	center.light = sum.Scale(1 / total)
+	center.variance = variance / (total * total)
+	return center
+}
@@ -0,0 +1,64 @@
+package spt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// a matt floor under a rough ball, lit by one big light
+func denoiseScene(passes, samples int, denoise *Denoiser) *Scene {
+	scene := tinyScene()
+	scene.Width, scene.Height = 64, 36
+	scene.Passes, scene.Samples = passes, samples
+	scene.Seed = 1
+	scene.AOV = true
+	scene.Camera = NewCamera(V3(0, -4000, 1500), V3(0, 0, 200), Z3, 40, Zero3, 0.0)
+	scene.Stuff = []Thing{
+		Object(Light(White.Scale(4)), Translate(V3(-7500, 0, 20000), Sphere(10000))),
+		Object(Metal(Color{0.8, 0.5, 0.3}, 0.6), Translate(V3(0, 0, 500), Sphere(500))),
+		Object(Matt(Color{0.5, 0.6, 0.7}), Translate(V3(0, 0, -50), Cube(20000, 20000, 100))),
+	}
+	var last *Scene
+	for frame := range RenderContext(context.Background(), scene, nil, RenderOptions{Deadline: time.Now().Add(time.Minute), Denoise: denoise}) {
+		last = frame.(*Scene)
+	}
+	return last
+}
+
+// mean squared error of displayed colors
+func displayError(a, b *Scene) float64 {
+	sum := 0.0
+	for y := 0; y < a.Height; y++ {
+		for x := 0; x < a.Width; x++ {
+			ca, _ := a.Linear(x, y)
+			cb, _ := b.Linear(x, y)
+			ca, cb = a.Display.Apply(ca), b.Display.Apply(cb)
+			d := Color{ca.R - cb.R, ca.G - cb.G, ca.B - cb.B}
+			sum += d.R*d.R + d.G*d.G + d.B*d.B
+		}
+	}
+	return sum / float64(a.Width*a.Height)
+}
+
+func TestDenoise(t *testing.T) {
+	reference := denoiseScene(4, 32, nil)
+	noisy := denoiseScene(1, 2, nil)
+	denoised := Denoiser{}.Denoise(noisy)
+
+	before, after := displayError(noisy, reference), displayError(denoised, reference)
+	t.Logf("error %.5f noisy, %.5f denoised", before, after)
+	if after > before/3 {
+		t.Errorf("error %.5f noisy, %.5f denoised", before, after)
+	}
+
+	// or as frames are rendered
+	if e := displayError(denoiseScene(1, 2, &Denoiser{}), reference); e > before/3 {
+		t.Errorf("error %.5f noisy, %.5f denoised while rendering", before, e)
+	}
+
+	// the reference itself is left alone, near enough
+	if e := displayError(Denoiser{}.Denoise(reference), reference); e > after/2 {
+		t.Errorf("denoising the reference moved it by %.5f", e)
+	}
+}
@@ -0,0 +1,279 @@
+package spt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// how often workers check in, by default
+	farmHeartbeat = 2 * time.Second
+	// how often a render looks for workers joining and leaving
+	farmPoll = 250 * time.Millisecond
+)
+
+var errWorkerUnknown = errors.New("unknown worker")
+
+// A coordinator that RPC workers dial into, rather than being handed a
+// fixed list of addresses. Workers join with their core count and send
+// heartbeats; those that go quiet are dropped, and renders using the farm
+// hand their tiles to someone else.
+type Farm struct {
+	sync.Mutex
+	// Secures both workers joining and the farm dialling back to render,
+	// so workers must share it
+	Transport Transport
+	heartbeat time.Duration
+	workers   map[string]*farmWorker
+}
+
+type farmWorker struct {
+	id       string
+	cores    int
+	seen     time.Time
+	renderer RPCRenderer
+}
+
+func NewFarm() *Farm {
+	return &Farm{
+		heartbeat: farmHeartbeat,
+		workers:   map[string]*farmWorker{},
+	}
+}
+
+// What a worker tells the farm about itself.
+type WorkerInfo struct {
+	Host  string // Optional, defaults to the address the worker dialled from
+	Port  int    // where the worker serves RenderRPC
+	Cores int
+}
+
+type JoinReply struct {
+	ID        string
+	Heartbeat time.Duration
+}
+
+// The farm's RPC methods, one per worker connection so they know who's
+// calling.
+type FarmRPC struct {
+	farm   *Farm
+	remote string
+}
+
+func (srv FarmRPC) Join(in WorkerInfo, out *JoinReply) error {
+	host := in.Host
+	if host == "" {
+		host = srv.remote
+	}
+	id := net.JoinHostPort(host, fmt.Sprint(in.Port))
+
+	f := srv.farm
+	f.Lock()
+	defer f.Unlock()
+	if w, ok := f.workers[id]; ok {
+		w.seen = time.Now()
+		w.cores = in.Cores
+	} else {
+		log.Println("farm join", id, in.Cores, "cores")
+		f.workers[id] = &farmWorker{
+			id:       id,
+			cores:    in.Cores,
+			seen:     time.Now(),
+			renderer: NewRPCRendererWith(id, f.Transport).(RPCRenderer),
+		}
+	}
+	*out = JoinReply{id, f.heartbeat}
+	return nil
+}
+
+func (srv FarmRPC) Heartbeat(id string, out *bool) error {
+	f := srv.farm
+	f.Lock()
+	defer f.Unlock()
+	w, ok := f.workers[id]
+	if !ok {
+		return errWorkerUnknown
+	}
+	w.seen = time.Now()
+	*out = true
+	return nil
+}
+
+func (srv FarmRPC) Leave(id string, out *bool) error {
+	srv.farm.drop(id)
+	*out = true
+	return nil
+}
+
+func (f *Farm) drop(id string) {
+	f.Lock()
+	defer f.Unlock()
+	if w, ok := f.workers[id]; ok {
+		log.Println("farm leave", id)
+		w.renderer.Close()
+		delete(f.workers, id)
+	}
+}
+
+// drop workers that missed three heartbeats
+func (f *Farm) reap() {
+	f.Lock()
+	var quiet []string
+	for id, w := range f.workers {
+		if time.Since(w.seen) > 3*f.heartbeat {
+			quiet = append(quiet, id)
+		}
+	}
+	f.Unlock()
+	for _, id := range quiet {
+		f.drop(id)
+	}
+}
+
+// the current workers, by id
+func (f *Farm) members() map[string]*farmWorker {
+	f.Lock()
+	defer f.Unlock()
+	members := map[string]*farmWorker{}
+	for id, w := range f.workers {
+		members[id] = w
+	}
+	return members
+}
+
+// A tile keeps at most one core per row busy, so give bigger workers
+// several tiles at once, plus one to cover the network round trip.
+func (w *farmWorker) slots(tile int) int {
+	if tile <= 0 {
+		tile = tileSize
+	}
+	return 1 + (w.cores+tile-1)/tile
+}
+
+// Accept workers on port until stop is closed.
+func (f *Farm) Serve(stop chan struct{}, port int) error {
+	listen, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	return f.serve(stop, listen)
+}
+
+func (f *Farm) serve(stop chan struct{}, listen net.Listener) error {
+	log.Println("farm ready", listen.Addr())
+
+	var group sync.WaitGroup
+	var open sync.Map
+
+	group.Add(1)
+	go func() {
+		defer group.Done()
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+			server := rpc.NewServer()
+			server.RegisterName("Farm", FarmRPC{f, host})
+			open.Store(conn, true)
+			group.Add(1)
+			go func() {
+				defer group.Done()
+				defer open.Delete(conn)
+				secure, err := f.Transport.accept(conn)
+				if err != nil {
+					log.Println("farm", host, err)
+					return
+				}
+				server.ServeConn(secure)
+			}()
+		}
+	}()
+
+	ticker := time.NewTicker(f.heartbeat)
+	defer ticker.Stop()
+
+	for run := true; run; {
+		select {
+		case <-ticker.C:
+			f.reap()
+		case <-stop:
+			run = false
+		}
+	}
+
+	listen.Close()
+	open.Range(func(conn, _ interface{}) bool {
+		conn.(net.Conn).Close()
+		return true
+	})
+	group.Wait()
+	log.Println("farm stopped")
+	return nil
+}
+
+// Keep a worker serving RenderRPC on port joined to the farm at
+// coordinator, rejoining with backoff whenever the connection drops,
+// until stop is closed.
+func JoinFarm(stop chan struct{}, coordinator string, port int) error {
+	return JoinFarmWith(stop, coordinator, port, Transport{})
+}
+
+// JoinFarm through a farm's Transport.
+func JoinFarmWith(stop chan struct{}, coordinator string, port int, transport Transport) error {
+	wait := retryMin
+	for {
+		joined, err := joinFarm(stop, coordinator, port, transport)
+		if err == nil {
+			return nil
+		}
+		if joined {
+			wait = retryMin
+		}
+		log.Println("rpc-server join", coordinator, err, "retry in", wait)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(wait):
+		}
+		wait = backoff(wait)
+	}
+}
+
+func joinFarm(stop chan struct{}, coordinator string, port int, transport Transport) (bool, error) {
+	conn, err := transport.dial(context.Background(), coordinator)
+	if err != nil {
+		return false, err
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	var reply JoinReply
+	if err := client.Call("Farm.Join", WorkerInfo{Port: port, Cores: runtime.NumCPU()}, &reply); err != nil {
+		return false, err
+	}
+	log.Println("rpc-server joined", coordinator, "as", reply.ID)
+
+	ticker := time.NewTicker(reply.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		var ok bool
+		select {
+		case <-stop:
+			return true, client.Call("Farm.Leave", reply.ID, &ok)
+		case <-ticker.C:
+			if err := client.Call("Farm.Heartbeat", reply.ID, &ok); err != nil {
+				return true, err
+			}
+		}
+	}
+}
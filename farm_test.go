@@ -0,0 +1,192 @@
+package spt
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	wait := retryMin
+	for i := 0; i < 3; i++ {
+		wait = backoff(wait)
+	}
+	if wait != 8*retryMin {
+		t.Errorf("backoff %v", wait)
+	}
+	for i := 0; i < 20; i++ {
+		wait = backoff(wait)
+	}
+	if wait != retryMax {
+		t.Errorf("backoff %v", wait)
+	}
+}
+
+func testFarm(t *testing.T, transport Transport) (*Farm, string, func()) {
+	farm := NewFarm()
+	farm.Transport = transport
+	farm.heartbeat = 50 * time.Millisecond
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		farm.serve(stop, listen)
+		close(done)
+	}()
+	return farm, listen.Addr().String(), func() {
+		close(stop)
+		<-done
+	}
+}
+
+func port(t *testing.T, addr string) int {
+	_, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(p)
+	return n
+}
+
+func waitFor(t *testing.T, what string, ok func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); !ok(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func farmRender(t *testing.T, farm *Farm) {
+	scene := tinyScene()
+	scene.Passes = 3
+	var last *Scene
+	for frame := range RenderContext(context.Background(), scene, nil, RenderOptions{
+		TileSize: 8,
+		Farm:     farm,
+		Deadline: time.Now().Add(30 * time.Second),
+	}) {
+		last = frame.(*Scene)
+	}
+	if last == nil {
+		t.Fatal("no frames")
+	}
+	for i, p := range last.Raster {
+		if p.Rays != int32(scene.Passes*scene.Samples) {
+			t.Fatalf("pixel %d has %d rays", i, p.Rays)
+		}
+	}
+}
+
+func TestFarm(t *testing.T) {
+	farm, coordinator, stopFarm := testFarm(t, Transport{})
+	defer stopFarm()
+
+	// two workers join and keep up their heartbeats
+	var stops []chan struct{}
+	for i := 0; i < 2; i++ {
+		addr, _, stopWorker := testWorker(t, newSceneCache(sceneCacheSize))
+		defer stopWorker()
+		stop := make(chan struct{})
+		stops = append(stops, stop)
+		go JoinFarm(stop, coordinator, port(t, addr))
+	}
+	waitFor(t, "workers to join", func() bool { return len(farm.members()) == 2 })
+
+	// well past the heartbeat timeout, nobody is dropped
+	time.Sleep(10 * farm.heartbeat)
+	if n := len(farm.members()); n != 2 {
+		t.Fatalf("%d workers after heartbeats", n)
+	}
+
+	farmRender(t, farm)
+
+	// leaving is immediate
+	close(stops[0])
+	waitFor(t, "a worker to leave", func() bool { return len(farm.members()) == 1 })
+	close(stops[1])
+	waitFor(t, "the last worker to leave", func() bool { return len(farm.members()) == 0 })
+}
+
+// a whole worker, as the commands run one, joins and leaves with stop
+func TestRenderWorker(t *testing.T) {
+	farm, coordinator, stopFarm := testFarm(t, Transport{})
+	defer stopFarm()
+
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	free := port(t, listen.Addr().String())
+	listen.Close()
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- RenderWorker(stop, free, "", coordinator, Transport{}, Transport{})
+	}()
+	waitFor(t, "the worker to join", func() bool { return len(farm.members()) == 1 })
+	farmRender(t, farm)
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	waitFor(t, "the worker to leave", func() bool { return len(farm.members()) == 0 })
+}
+
+func TestFarmDeadWorker(t *testing.T) {
+	farm, coordinator, stopFarm := testFarm(t, Transport{})
+	defer stopFarm()
+
+	// a worker that joins, takes tiles, and then goes silent
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	client, err := rpc.Dial("tcp", coordinator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var reply JoinReply
+	if err := client.Call("Farm.Join", WorkerInfo{Port: port(t, silent.Addr().String()), Cores: 64}, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	// a healthy worker turns up later, once the silent one is dropped
+	addr, _, stopWorker := testWorker(t, newSceneCache(sceneCacheSize))
+	defer stopWorker()
+	healthy := port(t, addr)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for len(farm.members()) > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		JoinFarm(stop, coordinator, healthy)
+	}()
+
+	farmRender(t, farm)
+
+	var ok bool
+	if err := client.Call("Farm.Heartbeat", reply.ID, &ok); err == nil || err.Error() != errWorkerUnknown.Error() {
+		t.Errorf("dropped worker's heartbeat: %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package spt
+
+import (
+	"encoding/gob"
+	"image"
+	"math"
+)
+
+func init() {
+	gob.Register(Box{})
+	gob.Register(Tent{})
+	gob.Register(Gaussian{})
+	gob.Register(Mitchell{})
+	gob.Register(Lanczos{})
+}
+
+// A reconstruction filter, sharing each sample among the pixels around
+// it. A sample dx, dy pixels from a pixel's center adds its color to that
+// pixel in proportion to Weight, and each pixel is its summed color over
+// its summed weight. Weights may be negative, to sharpen.
+type Filter interface {
+	Support() float64 // radius in pixels, beyond which weights are zero
+	Weight(dx, dy float64) float64
+}
+
+// Equal weights within Radius, 0.5 by default: the plain average of the
+// samples within each pixel.
+type Box struct {
+	Radius float64
+}
+
+func (f Box) Support() float64 {
+	return orDefault(f.Radius, 0.5)
+}
+
+func (f Box) Weight(dx, dy float64) float64 {
+	r := f.Support()
+	if math.Abs(dx) < r && math.Abs(dy) < r {
+		return 1
+	}
+	return 0
+}
+
+// Weights falling linearly to zero at Radius, 1 by default.
+type Tent struct {
+	Radius float64
+}
+
+func (f Tent) Support() float64 {
+	return orDefault(f.Radius, 1)
+}
+
+func (f Tent) Weight(dx, dy float64) float64 {
+	r := f.Support()
+	tent := func(x float64) float64 {
+		return math.Max(0, 1-math.Abs(x)/r)
+	}
+	return tent(dx) * tent(dy)
+}
+
+// A Gaussian of standard deviation Sigma, 0.5 by default, lowered to
+// reach zero at Radius, 1.5 by default.
+type Gaussian struct {
+	Radius float64
+	Sigma  float64
+}
+
+func (f Gaussian) Support() float64 {
+	return orDefault(f.Radius, 1.5)
+}
+
+func (f Gaussian) Weight(dx, dy float64) float64 {
+	r, sigma := f.Support(), orDefault(f.Sigma, 0.5)
+	gaussian := func(x float64) float64 {
+		return math.Exp(-x * x / (2 * sigma * sigma))
+	}
+	edge := gaussian(r)
+	return math.Max(0, gaussian(dx)-edge) * math.Max(0, gaussian(dy)-edge)
+}
+
+// Mitchell and Netravali's cubic over a radius of 2 pixels. B blurs and
+// C rings; both are 1/3 when zero, their recommended balance.
+type Mitchell struct {
+	B, C float64
+}
+
+func (f Mitchell) Support() float64 {
+	return 2
+}
+
+func (f Mitchell) Weight(dx, dy float64) float64 {
+	b, c := f.B, f.C
+	if b == 0 && c == 0 {
+		b, c = 1.0/3, 1.0/3
+	}
+	cubic := func(x float64) float64 {
+		x = math.Abs(x)
+		switch {
+		case x < 1:
+			return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+		case x < 2:
+			return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+		}
+		return 0
+	}
+	return cubic(dx) * cubic(dy)
+}
+
+// A sinc windowed by a wider sinc, with Radius lobes each side, 3 by
+// default. Sharpest of the filters, and rings the most.
+type Lanczos struct {
+	Radius float64
+}
+
+func (f Lanczos) Support() float64 {
+	return orDefault(f.Radius, 3)
+}
+
+func (f Lanczos) Weight(dx, dy float64) float64 {
+	r := f.Support()
+	lanczos := func(x float64) float64 {
+		if math.Abs(x) >= r {
+			return 0
+		}
+		return sinc(x) * sinc(x/r)
+	}
+	return lanczos(dx) * lanczos(dy)
+}
+
+func sinc(x float64) float64 {
+	if math.Abs(x) < 1e-9 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+func orDefault(v, def float64) float64 {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+// whole pixels a filter reaches beyond the pixel a sample is in
+func filterPad(f Filter) int {
+	if f == nil {
+		return 0
+	}
+	return int(math.Max(0, math.Ceil(f.Support()-0.5)))
+}
+
+// The part of the frame a tile's raster covers: its region, grown by
+// how far the filter spreads its samples.
+func (scene *Scene) splatBounds(region image.Rectangle) image.Rectangle {
+	pad := filterPad(scene.Filter)
+	return region.Inset(-pad).Intersect(scene.Bounds())
+}
+
+// a pixel's share of the samples spread to it
+type splat struct {
+	Color  Color
+	Alpha  float64
+	Weight float64
+}
+
+// weights are kept to at least this much per ray
+const filterMinWeight = 0.1
+
+// How much of a pixel's color is counted, by which its sum is divided:
+// the summed filter weights, or rays for rasters without them. Negative
+// lobes can leave a pixel with few samples next to no weight, or less, so
+// it's kept to a fraction of the rays to stop its mean blowing up.
+func (p *Pixel) weight() float64 {
+	if p.Weight == 0 {
+		return float64(p.Rays)
+	}
+	return math.Max(p.Weight, filterMinWeight*float64(p.Rays))
+}
+
+// a pixel's average color
+func (p *Pixel) mean() Color {
+	return p.Color.Scale(1 / p.weight())
+}
@@ -0,0 +1,121 @@
+package spt
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+var testFilters = []Filter{Box{}, Tent{}, Gaussian{}, Mitchell{}, Lanczos{}, Box{1}, Mitchell{1, 0}, Lanczos{2}}
+
+func TestFilters(t *testing.T) {
+	for _, f := range testFilters {
+		r := f.Support()
+		if f.Weight(0, 0) <= 0 {
+			t.Errorf("%#v: center weight %v", f, f.Weight(0, 0))
+		}
+		for _, d := range [][2]float64{{r, 0}, {0, r}, {-r, 0}, {r + 0.1, r + 0.1}} {
+			if w := f.Weight(d[0], d[1]); w != 0 {
+				t.Errorf("%#v: weight %v at %v", f, w, d)
+			}
+		}
+		if w, m := f.Weight(0.3, -0.2), f.Weight(-0.3, 0.2); w != m {
+			t.Errorf("%#v: asymmetric, %v and %v", f, w, m)
+		}
+	}
+	for _, c := range []struct {
+		filter Filter
+		pad    int
+	}{
+		{nil, 0}, {Box{}, 0}, {Tent{}, 1}, {Gaussian{}, 1}, {Mitchell{}, 2}, {Lanczos{}, 3},
+	} {
+		if pad := filterPad(c.filter); pad != c.pad {
+			t.Errorf("%#v: pad %d, want %d", c.filter, pad, c.pad)
+		}
+	}
+}
+
+// negative lobes can't leave a pixel dividing by next to nothing
+func TestFilterWeight(t *testing.T) {
+	for _, w := range []float64{1e-9, -1e-9, -0.5} {
+		p := Pixel{Color: White, Rays: 4, Weight: w}
+		if c := p.mean(); c.R <= 0 || c.R > 10 {
+			t.Errorf("weight %v: mean %v", w, c)
+		}
+	}
+	if p := (Pixel{Color: White, Rays: 4}); p.mean() != White.Scale(0.25) {
+		t.Errorf("unweighted mean %v", p.mean())
+	}
+}
+
+// the default box filter keeps each sample in its pixel, like no filter
+func TestFilterBox(t *testing.T) {
+	scene := tinyScene()
+	scene.Seed = 1
+	scene.Samples = 2
+	plain := scene.Render()
+	scene.Filter = Box{}
+	boxed := scene.Render()
+	for i := range plain {
+		if plain[i] != boxed[i] {
+			t.Fatalf("pixel %d: %+v, boxed %+v", i, plain[i], boxed[i])
+		}
+	}
+}
+
+// Samples spread across tile edges, and between workers, reach the
+// same pixels they would in a single tile: filters integrating to one
+// give pixels away from the frame's edges about as much weight as rays.
+func TestFilterTiles(t *testing.T) {
+	addr, _, stop := testWorker(t, newSceneCache(sceneCacheSize))
+	defer stop()
+	remote := NewRPCRenderer(addr)
+	defer remote.(RPCRenderer).Close()
+
+	for _, filter := range []Filter{Tent{}, Mitchell{}} {
+		for name, renderers := range map[string][]Renderer{
+			"local": {NewLocalRenderer()},
+			"rpc":   {remote},
+			"both":  {NewLocalRenderer(), remote},
+		} {
+			scene := tinyScene()
+			scene.Passes, scene.Samples = 2, 8
+			scene.Filter = filter
+			var last *Scene
+			for frame := range RenderContext(context.Background(), scene, renderers, RenderOptions{
+				TileSize: 5,
+				Deadline: time.Now().Add(30 * time.Second),
+			}) {
+				last = frame.(*Scene)
+			}
+			pad := filterPad(filter)
+			for y := pad; y < scene.Height-pad; y++ {
+				for x := pad; x < scene.Width-pad; x++ {
+					p := last.Raster[y*scene.Width+x]
+					if math.Abs(p.Weight/float64(p.Rays)-1) > 0.35 {
+						t.Fatalf("%#v %s: pixel %d,%d weight %v for %d rays", filter, name, x, y, p.Weight, p.Rays)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestFilterImage(t *testing.T) {
+	for _, filter := range testFilters {
+		scene := tinyScene()
+		scene.Seed = 1
+		scene.Samples = 4
+		scene.Filter = filter
+		scene.Raster = scene.Render()
+		for y := 0; y < scene.Height; y++ {
+			for x := 0; x < scene.Width; x++ {
+				c, _ := scene.Linear(x, y)
+				if math.IsNaN(c.R) || math.IsInf(c.R, 0) || c.Brightness() > 10 {
+					t.Fatalf("%#v: pixel %d,%d %v", filter, x, y, c)
+				}
+			}
+		}
+	}
+}
@@ -2,4 +2,7 @@ module github.com/seanpringle/spt
 
 go 1.13
 
-require github.com/slimsag/rand v0.0.0-20160325092440-f1e8d464c002
+require (
+	github.com/slimsag/rand v0.0.0-20160325092440-f1e8d464c002
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,260 @@
+package spt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// An image that keeps the linear radiance behind its 8-bit colors, as a
+// Scene does, for the high dynamic range formats.
+type LinearImage interface {
+	image.Image
+	Linear(x, y int) (Color, float64)
+}
+
+// Linear float pixels, RGBA row by row from the top, with alpha not
+// premultiplied.
+func LinearPixels(img LinearImage) []float32 {
+	b := img.Bounds()
+	pixels := make([]float32, 0, b.Dx()*b.Dy()*4)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c, a := img.Linear(x, y)
+			pixels = append(pixels, float32(c.R), float32(c.G), float32(c.B), float32(a))
+		}
+	}
+	return pixels
+}
+
+// Write an uncompressed OpenEXR image with 32-bit float RGBA channels.
+// Color is premultiplied by alpha, as EXR expects.
+func WriteEXR(w io.Writer, img LinearImage) error {
+	return writeEXR(w, img.Bounds(), rgbaChannels(img))
+}
+
+// A channel of an EXR image, named for the layer it belongs to, as in
+// normal.X, unless it is part of the main image.
+type exrChannel struct {
+	name  string
+	value func(x, y int) float32
+}
+
+// an image's premultiplied RGBA
+func rgbaChannels(img LinearImage) []exrChannel {
+	channel := func(name string, value func(c Color, a float64) float64) exrChannel {
+		return exrChannel{name, func(x, y int) float32 {
+			c, a := img.Linear(x, y)
+			return float32(value(c.Scale(a), a))
+		}}
+	}
+	return []exrChannel{
+		channel("R", func(c Color, a float64) float64 { return c.R }),
+		channel("G", func(c Color, a float64) float64 { return c.G }),
+		channel("B", func(c Color, a float64) float64 { return c.B }),
+		channel("A", func(c Color, a float64) float64 { return a }),
+	}
+}
+
+func writeEXR(w io.Writer, b image.Rectangle, channels []exrChannel) error {
+	width, height := b.Dx(), b.Dy()
+	// the header first, to know where the scanlines start
+	bw := new(bytes.Buffer)
+	put := func(v interface{}) {
+		binary.Write(bw, binary.LittleEndian, v)
+	}
+	attr := func(name, kind string, size int) {
+		bw.WriteString(name + "\x00" + kind + "\x00")
+		put(int32(size))
+	}
+	window := [4]int32{0, 0, int32(width - 1), int32(height - 1)}
+
+	put([]byte{0x76, 0x2f, 0x31, 0x01}) // magic
+	put(int32(2))                       // version 2, single part scanlines
+
+	// channels are stored in alphabetical order
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].name < channels[j].name
+	})
+	size := 1
+	for _, ch := range channels {
+		size += len(ch.name) + 1 + 4 + 4 + 4 + 4
+	}
+	attr("channels", "chlist", size)
+	for _, ch := range channels {
+		bw.WriteString(ch.name + "\x00")
+		put(int32(2))       // FLOAT
+		put([4]uint8{})     // pLinear and reserved
+		put([2]int32{1, 1}) // x and y sampling
+	}
+	bw.WriteByte(0)
+	attr("compression", "compression", 1)
+	bw.WriteByte(0) // NO_COMPRESSION
+	attr("dataWindow", "box2i", 16)
+	put(window)
+	attr("displayWindow", "box2i", 16)
+	put(window)
+	attr("lineOrder", "lineOrder", 1)
+	bw.WriteByte(0) // INCREASING_Y
+	attr("pixelAspectRatio", "float", 4)
+	put(float32(1))
+	attr("screenWindowCenter", "v2f", 8)
+	put([2]float32{})
+	attr("screenWindowWidth", "float", 4)
+	put(float32(1))
+	bw.WriteByte(0) // end of header
+
+	// one scanline per block, each a y, a size, and the channels in turn
+	header := int64(bw.Len())
+	line := width * len(channels) * 4
+	for y := 0; y < height; y++ {
+		put(uint64(header + int64(height)*8 + int64(y)*int64(8+line)))
+	}
+	row := make([]float32, width*len(channels))
+	for y := 0; y < height; y++ {
+		for i, ch := range channels {
+			for x := 0; x < width; x++ {
+				row[i*width+x] = ch.value(b.Min.X+x, b.Min.Y+y)
+			}
+		}
+		put(int32(y))
+		put(int32(line))
+		put(row)
+		if _, err := w.Write(bw.Bytes()); err != nil {
+			return err
+		}
+		bw.Reset()
+	}
+	return nil
+}
+
+// Write a Portable Float Map: RGB only, 32-bit floats, rows from the
+// bottom.
+func WritePFM(w io.Writer, img LinearImage) error {
+	b := img.Bounds()
+	bw := bufio.NewWriter(w)
+	// a negative scale means little-endian
+	fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", b.Dx(), b.Dy())
+	row := make([]float32, b.Dx()*3)
+	for y := b.Max.Y - 1; y >= b.Min.Y; y-- {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c, _ := img.Linear(x, y)
+			i := (x - b.Min.X) * 3
+			row[i], row[i+1], row[i+2] = float32(c.R), float32(c.G), float32(c.B)
+		}
+		binary.Write(bw, binary.LittleEndian, row)
+	}
+	return bw.Flush()
+}
+
+// a color as RGBE: a shared exponent and three 8-bit mantissas
+func rgbe(c Color) [4]uint8 {
+	max := math.Max(c.R, math.Max(c.G, c.B))
+	if max < 1e-32 {
+		return [4]uint8{}
+	}
+	frac, exp := math.Frexp(max)
+	scale := frac * 256 / max
+	u := func(v float64) uint8 {
+		return uint8(math.Max(0, v*scale))
+	}
+	return [4]uint8{u(c.R), u(c.G), u(c.B), uint8(exp + 128)}
+}
+
+// Write a Radiance RGBE .hdr image, run-length encoded where the format
+// allows. RGB only.
+func WriteHDR(w io.Writer, img LinearImage) error {
+	b := img.Bounds()
+	width := b.Dx()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", b.Dy(), width)
+
+	// only widths from 8 to 32767 may be encoded; the rest are flat
+	encode := width >= 8 && width < 0x8000
+	row := make([][4]uint8, width)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c, _ := img.Linear(x, y)
+			row[x-b.Min.X] = rgbe(c)
+		}
+		if !encode {
+			for _, p := range row {
+				bw.Write(p[:])
+			}
+			continue
+		}
+		bw.Write([]byte{2, 2, uint8(width >> 8), uint8(width)})
+		// each component separately, in runs and literals
+		for i := 0; i < 4; i++ {
+			for x := 0; x < width; {
+				run := 1
+				for x+run < width && run < 127 && row[x+run][i] == row[x][i] {
+					run++
+				}
+				if run > 2 {
+					bw.Write([]byte{uint8(128 + run), row[x][i]})
+					x += run
+					continue
+				}
+				// literals up to the next run of three or more
+				n := 0
+				for x+n < width && n < 128 {
+					if x+n+2 < width && row[x+n][i] == row[x+n+1][i] && row[x+n][i] == row[x+n+2][i] {
+						break
+					}
+					n++
+				}
+				bw.WriteByte(uint8(n))
+				for j := 0; j < n; j++ {
+					bw.WriteByte(row[x+j][i])
+				}
+				x += n
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// Save an image as PNG, or as EXR, PFM or HDR when it has linear pixels,
+// depending on the file extension.
+func SaveImage(img image.Image, path string) error {
+	var encode func(io.Writer, LinearImage) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+	case ".exr":
+		encode = WriteEXR
+	case ".pfm":
+		encode = WritePFM
+	case ".hdr":
+		encode = WriteHDR
+	default:
+		return fmt.Errorf("unknown image format: %s", path)
+	}
+	linear, ok := img.(LinearImage)
+	if encode != nil && !ok {
+		return fmt.Errorf("%s: no linear pixels in a %T", path, img)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if encode == nil {
+		err = png.Encode(file, img)
+	} else {
+		err = encode(file, linear)
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,301 @@
+package spt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// a scene with bright, dark, empty and shadow-only pixels, and no render
+func hdrScene(width, height int) *Scene {
+	scene := &Scene{Width: width, Height: height, ShadowH: 0.5}
+	scene.Raster = make(Raster, width*height)
+	for i := range scene.Raster {
+		x, y := i%width, i/width
+		p := &scene.Raster[i]
+		p.Rays = 4
+		p.Alpha = 4
+		p.Color = Color{float64(x), float64(y) / 8, 0.001 * float64(i)}.Scale(4)
+		switch {
+		case x == 1 && y == 1:
+			*p = Pixel{}
+		case x == 2 && y == 1:
+			p.Alpha = 1 // a quarter of the rays caught shadows
+		case y == 2:
+			p.Color = Color{0.25, 0.25, 0.25} // a run
+		}
+	}
+	return scene
+}
+
+func TestLinear(t *testing.T) {
+	scene := hdrScene(4, 3)
+	if c, a := scene.Linear(3, 0); c != (Color{3, 0, 0.003}) || a != 1 {
+		t.Errorf("bright %v %v", c, a)
+	}
+	if r, _, _, _ := scene.At(3, 0).RGBA(); r != 0xffff {
+		t.Errorf("bright pixel not clamped: %x", r)
+	}
+	if c, a := scene.Linear(1, 1); c != Naught || a != 0 {
+		t.Errorf("empty %v %v", c, a)
+	}
+	if _, a := scene.Linear(2, 1); a != 0.25 {
+		t.Errorf("shadow alpha %v", a)
+	}
+	pixels := LinearPixels(scene)
+	if len(pixels) != 4*3*4 || pixels[4*(4+2)+3] != 0.25 || pixels[4*3] != 3 {
+		t.Errorf("pixels %v", pixels)
+	}
+}
+
+func near32(a, b float32) bool {
+	return math.Abs(float64(a-b)) <= 1e-6*math.Max(1, math.Abs(float64(a)))
+}
+
+// read back the parts of an EXR that WriteEXR writes, by channel
+func readEXR(data []byte) (width, height int, channels map[string][]float32, err error) {
+	r := bytes.NewReader(data)
+	var magic, version int32
+	binary.Read(r, binary.LittleEndian, &magic)
+	binary.Read(r, binary.LittleEndian, &version)
+	if magic != 20000630 || version != 2 {
+		return 0, 0, nil, fmt.Errorf("magic %d version %d", magic, version)
+	}
+	str := func() string {
+		var s []byte
+		for {
+			b, _ := r.ReadByte()
+			if b == 0 {
+				return string(s)
+			}
+			s = append(s, b)
+		}
+	}
+	attrs := map[string][]byte{}
+	for {
+		name := str()
+		if name == "" {
+			break
+		}
+		str()
+		var size int32
+		binary.Read(r, binary.LittleEndian, &size)
+		value := make([]byte, size)
+		io.ReadFull(r, value)
+		attrs[name] = value
+	}
+	if !bytes.Equal(attrs["compression"], []byte{0}) {
+		return 0, 0, nil, fmt.Errorf("compression %v", attrs["compression"])
+	}
+	var names []string
+	for ch := bytes.NewBuffer(attrs["channels"]); ch.Len() > 1; ch.Next(16) {
+		name, _ := ch.ReadString(0)
+		names = append(names, name[:len(name)-1])
+		if ch.Bytes()[0] != 2 {
+			return 0, 0, nil, fmt.Errorf("channel %s type %d", name, ch.Bytes()[0])
+		}
+	}
+	if !sort.StringsAreSorted(names) {
+		return 0, 0, nil, fmt.Errorf("channels %v", names)
+	}
+	var window [4]int32
+	binary.Read(bytes.NewReader(attrs["dataWindow"]), binary.LittleEndian, &window)
+	width, height = int(window[2]-window[0]+1), int(window[3]-window[1]+1)
+
+	offsets := make([]uint64, height)
+	binary.Read(r, binary.LittleEndian, offsets)
+	channels = map[string][]float32{}
+	for _, name := range names {
+		channels[name] = make([]float32, width*height)
+	}
+	row := make([]float32, width*len(names))
+	for _, offset := range offsets {
+		block := bytes.NewReader(data[offset:])
+		var y, size int32
+		binary.Read(block, binary.LittleEndian, &y)
+		binary.Read(block, binary.LittleEndian, &size)
+		if int(size) != len(row)*4 {
+			return 0, 0, nil, fmt.Errorf("line %d size %d", y, size)
+		}
+		if err := binary.Read(block, binary.LittleEndian, row); err != nil {
+			return 0, 0, nil, err
+		}
+		for i, name := range names {
+			copy(channels[name][int(y)*width:], row[i*width:(i+1)*width])
+		}
+	}
+	return width, height, channels, nil
+}
+
+func readPFM(data []byte) (width, height int, pixels []float32, err error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	var scale float64
+	if _, err := fmt.Fscanf(r, "PF\n%d %d\n%g\n", &width, &height, &scale); err != nil {
+		return 0, 0, nil, err
+	}
+	if scale >= 0 {
+		return 0, 0, nil, fmt.Errorf("big-endian")
+	}
+	pixels = make([]float32, width*height*3)
+	row := make([]float32, width*3)
+	for y := height - 1; y >= 0; y-- {
+		if err := binary.Read(r, binary.LittleEndian, row); err != nil {
+			return 0, 0, nil, err
+		}
+		copy(pixels[y*width*3:], row)
+	}
+	return width, height, pixels, nil
+}
+
+func readHDR(data []byte) (width, height int, pixels []float32, err error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if line == "\n" {
+			break
+		}
+	}
+	if _, err := fmt.Fscanf(r, "-Y %d +X %d\n", &height, &width); err != nil {
+		return 0, 0, nil, err
+	}
+	pixels = make([]float32, width*height*3)
+	row := make([][4]uint8, width)
+	for y := 0; y < height; y++ {
+		head := make([]byte, 4)
+		if width >= 8 {
+			io.ReadFull(r, head)
+			if head[0] != 2 || head[1] != 2 || int(head[2])<<8|int(head[3]) != width {
+				return 0, 0, nil, fmt.Errorf("line %d header %v", y, head)
+			}
+			for i := 0; i < 4; i++ {
+				for x := 0; x < width; {
+					n, _ := r.ReadByte()
+					if n > 128 {
+						v, _ := r.ReadByte()
+						for j := 0; j < int(n)-128; j++ {
+							row[x+j][i] = v
+						}
+						x += int(n) - 128
+						continue
+					}
+					for j := 0; j < int(n); j++ {
+						row[x+j][i], _ = r.ReadByte()
+					}
+					x += int(n)
+				}
+			}
+		} else {
+			for x := range row {
+				io.ReadFull(r, row[x][:])
+			}
+		}
+		for x, p := range row {
+			scale := 0.0
+			if p[3] != 0 {
+				scale = math.Ldexp(1, int(p[3])-136)
+			}
+			for i := 0; i < 3; i++ {
+				pixels[(y*width+x)*3+i] = float32((float64(p[i]) + 0.5) * scale)
+			}
+		}
+	}
+	return width, height, pixels, nil
+}
+
+func TestHDRWriters(t *testing.T) {
+	for _, size := range [][2]int{{13, 5}, {5, 4}} {
+		scene := hdrScene(size[0], size[1])
+		want := LinearPixels(scene)
+
+		buf := new(bytes.Buffer)
+		if err := WriteEXR(buf, scene); err != nil {
+			t.Fatal(err)
+		}
+		w, h, exr, err := readEXR(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w != scene.Width || h != scene.Height || len(exr) != 4 {
+			t.Fatalf("exr %dx%d %d channels", w, h, len(exr))
+		}
+		for i := 0; i < len(want)/4; i++ {
+			// premultiplied
+			a := want[i*4+3]
+			got := []float32{exr["R"][i], exr["G"][i], exr["B"][i], exr["A"][i]}
+			if !near32(got[0], want[i*4]*a) || !near32(got[1], want[i*4+1]*a) || !near32(got[2], want[i*4+2]*a) || got[3] != a {
+				t.Fatalf("exr pixel %d: %v, want %v", i, got, want[i*4:i*4+4])
+			}
+		}
+
+		buf.Reset()
+		if err := WritePFM(buf, scene); err != nil {
+			t.Fatal(err)
+		}
+		w, h, got, err := readPFM(buf.Bytes())
+		if err != nil || w != scene.Width || h != scene.Height {
+			t.Fatalf("pfm %dx%d %v", w, h, err)
+		}
+		for i := 0; i < len(want)/4; i++ {
+			for c := 0; c < 3; c++ {
+				if got[i*3+c] != want[i*4+c] {
+					t.Fatalf("pfm pixel %d: %v, want %v", i, got[i*3:i*3+3], want[i*4:i*4+3])
+				}
+			}
+		}
+
+		buf.Reset()
+		if err := WriteHDR(buf, scene); err != nil {
+			t.Fatal(err)
+		}
+		w, h, got, err = readHDR(buf.Bytes())
+		if err != nil || w != scene.Width || h != scene.Height {
+			t.Fatalf("hdr %dx%d %v", w, h, err)
+		}
+		for i := 0; i < len(want)/4; i++ {
+			max := math.Max(float64(want[i*4]), math.Max(float64(want[i*4+1]), float64(want[i*4+2])))
+			for c := 0; c < 3; c++ {
+				// eight bits of mantissa relative to the brightest channel
+				if math.Abs(float64(got[i*3+c]-want[i*4+c])) > max/128+1e-30 {
+					t.Fatalf("hdr pixel %d: %v, want %v", i, got[i*3:i*3+3], want[i*4:i*4+3])
+				}
+			}
+		}
+	}
+}
+
+func TestSaveImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spt-image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	scene := hdrScene(13, 5)
+	for _, name := range []string{"a.png", "a.exr", "a.pfm", "a.hdr"} {
+		path := filepath.Join(dir, name)
+		if err := SaveImage(scene, path); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if err := SaveImage(scene, filepath.Join(dir, "a.tiff")); err == nil {
+		t.Error("saved a .tiff")
+	}
+	if err := SaveImage(image.NewRGBA(scene.Bounds()), filepath.Join(dir, "b.exr")); err == nil {
+		t.Error("saved an EXR without linear pixels")
+	}
+}
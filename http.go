@@ -0,0 +1,549 @@
+package spt
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// renders waiting behind the current one before POSTs are turned away
+	httpQueue = 64
+	// finished jobs kept around for their images
+	httpKept = 32
+	// largest scene accepted
+	httpMaxScene = 256 << 20
+	// largest image accepted, in pixels
+	httpMaxPixels = 1 << 24
+	// most passes a job may ask for, besides 0 for unlimited
+	httpMaxPasses = 1 << 16
+)
+
+// Job states, as reported by JobStatus.
+const (
+	JobQueued    = "queued"
+	JobRendering = "rendering"
+	JobDone      = "done"
+	JobCancelled = "cancelled"
+)
+
+// What the HTTP server says about a job, as JSON.
+type JobStatus struct {
+	ID       string
+	State    string
+	Width    int
+	Height   int
+	Progress Progress
+	Queued   time.Time
+	Started  time.Time `json:",omitempty"`
+	Finished time.Time `json:",omitempty"`
+}
+
+// An HTTP front end for rendering, one job at a time.
+//
+//	POST   /jobs                    queue a scene file, or a gob-encoded Scene
+//	GET    /jobs                    status of every job
+//	GET    /jobs/{id}               status of a job
+//	DELETE /jobs/{id}               cancel a job
+//	GET    /jobs/{id}/image.png     the image so far
+//	GET    /jobs/{id}/stream.mjpeg  the image after every pass, for a browser
+//	GET    /jobs/{id}/events        status after every pass, as server-sent events
+//
+// POST /jobs?timeout=10m limits a job's render time, which suits scenes
+// with unlimited Passes.
+//
+// With Token set, every request must present it, as a bearer token in
+// the Authorization header or, for a browser, as ?token=.
+type HTTPServer struct {
+	Token string // Optional shared secret
+	sync.Mutex
+	renderers []Renderer
+	options   RenderOptions
+	ctx       context.Context
+	cancel    context.CancelFunc
+	queue     chan *httpJob
+	jobs      map[string]*httpJob
+	order     []*httpJob // oldest first
+	next      int
+}
+
+type httpJob struct {
+	sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	scene   Scene
+	timeout time.Duration
+	status  JobStatus
+	frame   image.Image
+	changed chan struct{} // closed on every frame and change of state
+}
+
+// Serve jobs with renderers, or the local machine if there are none.
+// Deadline in options is ignored in favour of each job's timeout.
+func NewHTTPServer(renderers []Renderer, options RenderOptions) *HTTPServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &HTTPServer{
+		renderers: renderers,
+		options:   options,
+		ctx:       ctx,
+		cancel:    cancel,
+		queue:     make(chan *httpJob, httpQueue),
+		jobs:      map[string]*httpJob{},
+	}
+	go s.run()
+	return s
+}
+
+// Cancel every job and stop rendering.
+func (s *HTTPServer) Close() error {
+	s.cancel()
+	return nil
+}
+
+func (s *HTTPServer) run() {
+	for {
+		select {
+		case job := <-s.queue:
+			s.render(job)
+		case <-s.ctx.Done():
+			// let anyone watching a queued job go
+			for {
+				select {
+				case job := <-s.queue:
+					job.finish()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *HTTPServer) render(job *httpJob) {
+	if job.ctx.Err() != nil {
+		job.finish()
+		return
+	}
+
+	job.update(func() {
+		job.status.State = JobRendering
+		job.status.Started = time.Now()
+	})
+	log.Println("http-server render", job.status.ID, job.scene.Width, "x", job.scene.Height)
+
+	options := s.options
+	options.Deadline = time.Time{}
+	if job.timeout > 0 {
+		options.Deadline = time.Now().Add(job.timeout)
+	}
+	options.Progress = func(p Progress) {
+		job.Lock()
+		job.status.Progress = p
+		job.Unlock()
+		if s.options.Progress != nil {
+			s.options.Progress(p)
+		}
+	}
+
+	for frame := range RenderContext(job.ctx, job.scene, s.renderers, options) {
+		job.update(func() {
+			job.frame = frame
+		})
+	}
+	job.finish()
+	status, _, _ := job.watch()
+	log.Println("http-server", status.State, status.ID)
+}
+
+// Change a job and wake everyone watching it.
+func (job *httpJob) update(change func()) {
+	job.Lock()
+	defer job.Unlock()
+	change()
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+func (job *httpJob) finish() {
+	cancelled := job.ctx.Err() == context.Canceled
+	job.cancel()
+	job.update(func() {
+		if job.status.finished() {
+			return
+		}
+		job.status.State = JobDone
+		if cancelled {
+			job.status.State = JobCancelled
+		}
+		job.status.Finished = time.Now()
+	})
+}
+
+// the job as it is now, and a channel closed when that changes
+func (job *httpJob) watch() (JobStatus, image.Image, chan struct{}) {
+	job.Lock()
+	defer job.Unlock()
+	return job.status, job.frame, job.changed
+}
+
+func (status JobStatus) finished() bool {
+	return status.State == JobDone || status.State == JobCancelled
+}
+
+func (s *HTTPServer) job(id string) *httpJob {
+	s.Lock()
+	defer s.Unlock()
+	return s.jobs[id]
+}
+
+// Queue a scene, forgetting the oldest finished jobs beyond httpKept.
+func (s *HTTPServer) add(scene Scene, timeout time.Duration) (*httpJob, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.next++
+	ctx, cancel := context.WithCancel(s.ctx)
+	job := &httpJob{
+		ctx:     ctx,
+		cancel:  cancel,
+		scene:   scene,
+		timeout: timeout,
+		status: JobStatus{
+			ID:     strconv.Itoa(s.next),
+			State:  JobQueued,
+			Width:  scene.Width,
+			Height: scene.Height,
+			Queued: time.Now(),
+		},
+		changed: make(chan struct{}),
+	}
+
+	select {
+	case s.queue <- job:
+	default:
+		cancel()
+		return nil, errors.New("render queue is full")
+	}
+
+	s.jobs[job.status.ID] = job
+	s.order = append(s.order, job)
+
+	finished := 0
+	for _, old := range s.order {
+		if status, _, _ := old.watch(); status.finished() {
+			finished++
+		}
+	}
+	kept := s.order[:0]
+	for _, old := range s.order {
+		if status, _, _ := old.watch(); status.finished() && finished > httpKept {
+			delete(s.jobs, status.ID)
+			finished--
+			continue
+		}
+		kept = append(kept, old)
+	}
+	s.order = kept
+
+	return job, nil
+}
+
+// whether a request carries the token, when there is one
+func (s *HTTPServer) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="spt"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if path[0] != "jobs" || len(path) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(path) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			s.list(w)
+		case http.MethodPost:
+			s.post(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	job := s.job(path[1])
+	if job == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(path) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			status, _, _ := job.watch()
+			writeJSON(w, http.StatusOK, status)
+		case http.MethodDelete:
+			job.cancel()
+			// a rendering job finishes once its workers stop
+			if status, _, _ := job.watch(); status.State == JobQueued {
+				job.finish()
+			}
+			status, _, _ := job.watch()
+			writeJSON(w, http.StatusOK, status)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch path[2] {
+	case "image.png":
+		_, frame, _ := job.watch()
+		if frame == nil {
+			http.Error(w, "no image yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		png.Encode(w, frame)
+	case "stream.mjpeg":
+		s.stream(w, r, job)
+	case "events":
+		s.events(w, r, job)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *HTTPServer) list(w http.ResponseWriter) {
+	s.Lock()
+	jobs := append([]*httpJob{}, s.order...)
+	s.Unlock()
+
+	statuses := []JobStatus{}
+	for _, job := range jobs {
+		status, _, _ := job.watch()
+		statuses = append(statuses, status)
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// Read a POSTed scene.
+func decodeScene(r *http.Request) (Scene, error) {
+	var scene Scene
+	kind, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch kind {
+	case "", "application/octet-stream", "application/x-gob":
+		if err := gob.NewDecoder(r.Body).Decode(&scene); err != nil {
+			return scene, err
+		}
+	case "application/json", "application/yaml", "application/x-yaml", "text/yaml":
+		var err error
+		if scene, err = ReadScene(r.Body); err != nil {
+			return scene, err
+		}
+	default:
+		return scene, fmt.Errorf("unsupported scene type %q", kind)
+	}
+	if scene.Width <= 0 || scene.Height <= 0 {
+		return scene, errors.New("scene has no pixels")
+	}
+	if scene.Width > httpMaxPixels || scene.Height > httpMaxPixels || scene.Width*scene.Height > httpMaxPixels {
+		return scene, fmt.Errorf("%dx%d is more than %d pixels", scene.Width, scene.Height, httpMaxPixels)
+	}
+	if scene.Samples < 0 || scene.Samples > MaxSamples {
+		return scene, fmt.Errorf("samples must be 0 to %d", MaxSamples)
+	}
+	if scene.Passes < 0 || scene.Passes > httpMaxPasses {
+		return scene, fmt.Errorf("passes must be 0 to %d", httpMaxPasses)
+	}
+	if len(scene.Stuff) == 0 {
+		return scene, errors.New("scene has no stuff")
+	}
+	scene.Raster = nil
+	scene.Budget = nil
+	scene.Taken = nil
+	return scene, nil
+}
+
+func (s *HTTPServer) post(w http.ResponseWriter, r *http.Request) {
+	var timeout time.Duration
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, httpMaxScene)
+	scene, err := decodeScene(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := s.add(scene, timeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	status, _, _ := job.watch()
+	w.Header().Set("Location", "/jobs/"+status.ID)
+	writeJSON(w, http.StatusCreated, status)
+}
+
+// Call send with the job now and after every change, until it finishes or
+// the client goes away.
+func follow(r *http.Request, job *httpJob, send func(JobStatus, image.Image) error) {
+	for {
+		status, frame, changed := job.watch()
+		if err := send(status, frame); err != nil || status.finished() {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Motion JPEG, which browsers show in an <img> or on its own.
+func (s *HTTPServer) stream(w http.ResponseWriter, r *http.Request, job *httpJob) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	parts := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+parts.Boundary())
+	w.Header().Set("Cache-Control", "no-store")
+
+	var last image.Image
+	follow(r, job, func(status JobStatus, frame image.Image) error {
+		if frame == nil || frame == last {
+			return nil
+		}
+		last = frame
+		part, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {"image/jpeg"}})
+		if err != nil {
+			return err
+		}
+		if err := jpeg.Encode(part, frame, &jpeg.Options{Quality: 90}); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	parts.Close()
+}
+
+// Server-sent events: the job's status whenever a pass is merged or its
+// state changes.
+func (s *HTTPServer) events(w http.ResponseWriter, r *http.Request, job *httpJob) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+
+	follow(r, job, func(status JobStatus, frame image.Image) error {
+		data, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
+
+// Serve HTTP on addr, such as "localhost:8080", until stop is closed.
+func RenderServeHTTP(stop chan struct{}, addr string, renderers []Renderer) error {
+	return RenderServeHTTPWith(stop, addr, renderers, Transport{})
+}
+
+// Serve HTTPS when the transport has TLS, and require its token of
+// every request when it has one.
+func RenderServeHTTPWith(stop chan struct{}, addr string, renderers []Renderer, transport Transport) error {
+	handler := NewHTTPServer(renderers, RenderOptions{})
+	handler.Token = transport.Token
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: transport.TLS,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-stop
+		log.Println("http-server stopping...")
+		// finishing the jobs ends their streams, letting Shutdown go
+		handler.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			server.Close()
+		}
+	}()
+
+	log.Println("http-server ready")
+	var err error
+	if transport.TLS != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+	<-done
+	log.Println("http-server stopped")
+	return nil
+}
@@ -0,0 +1,301 @@
+package spt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postScene(t *testing.T, url string, scene Scene) JobStatus {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(scene); err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Post(url, "application/x-gob", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("post: %s", res.Status)
+	}
+	var status JobStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if res.Header.Get("Location") != "/jobs/"+status.ID {
+		t.Errorf("location %q", res.Header.Get("Location"))
+	}
+	return status
+}
+
+func getStatus(t *testing.T, url string) JobStatus {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var status JobStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestHTTPServer(t *testing.T) {
+	handler := NewHTTPServer(nil, RenderOptions{TileSize: 8})
+	defer handler.Close()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	scene := tinyScene()
+	scene.Passes = 3
+	job := server.URL + "/jobs/" + postScene(t, server.URL+"/jobs", scene).ID
+
+	// the stream has a frame per pass, and ends with the job
+	res, err := http.Get(job + "/stream.mjpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kind, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || kind != "multipart/x-mixed-replace" {
+		t.Fatalf("stream type %q %v", kind, err)
+	}
+	parts := multipart.NewReader(res.Body, params["boundary"])
+	frames := 0
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := jpeg.Decode(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds() != scene.Bounds() {
+			t.Errorf("frame bounds %v", img.Bounds())
+		}
+		frames++
+	}
+	res.Body.Close()
+	// a stream opened after the first merge starts from the latest frame
+	if frames < 1 || frames > scene.Passes {
+		t.Errorf("%d frames", frames)
+	}
+
+	status := getStatus(t, job)
+	if status.State != JobDone || status.Progress.Merged != scene.Passes {
+		t.Errorf("status %+v", status)
+	}
+
+	res, err = http.Get(job + "/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != scene.Bounds() {
+		t.Errorf("image bounds %v", img.Bounds())
+	}
+
+	res, err = http.Get(server.URL + "/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []JobStatus
+	json.NewDecoder(res.Body).Decode(&all)
+	res.Body.Close()
+	if len(all) != 1 || all[0].ID != status.ID {
+		t.Errorf("jobs %+v", all)
+	}
+
+	for url, code := range map[string]int{
+		server.URL + "/jobs/999":       http.StatusNotFound,
+		job + "/nothing":               http.StatusNotFound,
+		server.URL + "/elsewhere":      http.StatusNotFound,
+		server.URL + "/jobs/999/image": http.StatusNotFound,
+	} {
+		res, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != code {
+			t.Errorf("%s: %s", url, res.Status)
+		}
+	}
+
+	res, err = http.Post(server.URL+"/jobs", "application/x-gob", strings.NewReader("rubbish"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("rubbish: %s", res.Status)
+	}
+
+	// scene files too, with their mistakes pointed out
+	buf := new(bytes.Buffer)
+	scene.Passes = 1
+	if err := WriteScene(buf, scene, SceneYAML); err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.Post(server.URL+"/jobs", "application/yaml", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("yaml: %s", res.Status)
+	}
+	res, err = http.Post(server.URL+"/jobs", "application/json", strings.NewReader("{\n\"version\": 7\n}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest || !strings.HasPrefix(string(body), "2:12: version: unsupported version 7") {
+		t.Errorf("json: %s %s", res.Status, body)
+	}
+}
+
+func TestHTTPEvents(t *testing.T) {
+	handler := NewHTTPServer(nil, RenderOptions{TileSize: 8})
+	defer handler.Close()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// an endless render holds up the one queued behind it
+	endless := tinyScene()
+	endless.Passes = 0
+	next := tinyScene()
+	next.Passes = 2
+	first := server.URL + "/jobs/" + postScene(t, server.URL+"/jobs", endless).ID
+	second := server.URL + "/jobs/" + postScene(t, server.URL+"/jobs", next).ID
+
+	res, err := http.Get(first + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events type %q", res.Header.Get("Content-Type"))
+	}
+
+	// cancel the endless render after a couple of passes
+	var last JobStatus
+	cancelled := false
+	lines := bufio.NewScanner(res.Body)
+	for lines.Scan() {
+		line := lines.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &last); err != nil {
+			t.Fatal(err)
+		}
+		// events may skip passes merged in quick succession
+		if last.Progress.Merged >= 2 && !cancelled {
+			cancelled = true
+			req, _ := http.NewRequest(http.MethodDelete, first, nil)
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+		}
+	}
+	res.Body.Close()
+	if last.State != JobCancelled || last.Progress.Merged < 2 {
+		t.Errorf("last event %+v", last)
+	}
+
+	// and the next one gets its turn
+	res, err = http.Get(second + "/stream.mjpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if status := getStatus(t, second); status.State != JobDone {
+		t.Errorf("second job %+v", status)
+	}
+}
+
+func TestHTTPLimits(t *testing.T) {
+	handler := NewHTTPServer(nil, RenderOptions{TileSize: 8})
+	defer handler.Close()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	huge := tinyScene()
+	huge.Width, huge.Height = 1<<30, 1<<30
+	wide := tinyScene()
+	wide.Width, wide.Height = 1<<14, 1<<14
+	greedy := tinyScene()
+	greedy.Samples = MaxSamples + 1
+	long := tinyScene()
+	long.Passes = httpMaxPasses + 1
+	for name, scene := range map[string]Scene{"huge": huge, "wide": wide, "samples": greedy, "passes": long} {
+		buf := new(bytes.Buffer)
+		if err := gob.NewEncoder(buf).Encode(scene); err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.Post(server.URL+"/jobs", "application/x-gob", buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %s", name, res.Status)
+		}
+	}
+}
+
+func TestHTTPToken(t *testing.T) {
+	handler := NewHTTPServer(nil, RenderOptions{TileSize: 8})
+	handler.Token = "s3cret"
+	defer handler.Close()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, c := range []struct {
+		url, auth string
+		code      int
+	}{
+		{"/jobs", "", http.StatusUnauthorized},
+		{"/jobs", "Bearer wrong", http.StatusUnauthorized},
+		{"/jobs?token=wrong", "", http.StatusUnauthorized},
+		{"/jobs", "Bearer s3cret", http.StatusOK},
+		{"/jobs?token=s3cret", "", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+c.url, nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.code {
+			t.Errorf("%s %q: %s", c.url, c.auth, res.Status)
+		}
+	}
+}
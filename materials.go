@@ -22,18 +22,15 @@ var (
 	Brass     = Metal(Color{0.80, 0.58, 0.45}, 0.9)
 )
 
-// choose a vec3 less than unit
+// choose a vec3 less than unit, from exactly three numbers so that
+// samplers' later dimensions stay in step: a height and an angle pick a
+// direction, and the radius spreads the points evenly through the ball
 func pickVec3(rnd Random) Vec3 {
-	for {
-		v := Vec3{
-			rnd.Float64()*2 - 1,
-			rnd.Float64()*2 - 1,
-			rnd.Float64()*2 - 1,
-		}
-		if v.Dot(v) < 1.0 {
-			return v
-		}
-	}
+	z := rnd.Float64()*2 - 1
+	angle := rnd.Float64() * 2 * math.Pi
+	radius := math.Cbrt(rnd.Float64())
+	ring := math.Sqrt(1 - z*z)
+	return Vec3{ring * math.Cos(angle), ring * math.Sin(angle), z}.Scale(radius)
 }
 
 type Material interface {
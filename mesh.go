@@ -0,0 +1,610 @@
+package spt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Facet struct {
+	A, B, C Vec3
+}
+
+func (f Facet) Normal() Vec3 {
+	n := f.B.Sub(f.A).Cross(f.C.Sub(f.A))
+	if l := n.Length(); l > 0 {
+		return n.Scale(1.0 / l)
+	}
+	return Zero3
+}
+
+type Mesh struct {
+	Facets []Facet
+}
+
+// A regular grid of SDF samples covering a bounding sphere, with one
+// cell of padding on every side so the surface never touches the edge.
+type meshGrid struct {
+	sdf    func(Vec3) float64
+	origin Vec3
+	step   float64
+	n      int // points per axis
+	values []float64
+}
+
+func newMeshGrid(s SDF3, resolution int) *meshGrid {
+	center, radius := s.Sphere()
+	step := radius * 2 / float64(resolution)
+	g := &meshGrid{
+		sdf:    s.SDF(),
+		origin: center.Sub(V3(radius+step, radius+step, radius+step)),
+		step:   step,
+		n:      resolution + 3,
+	}
+	g.values = make([]float64, g.n*g.n*g.n)
+	parallel(g.n, func(k int) {
+		for j := 0; j < g.n; j++ {
+			for i := 0; i < g.n; i++ {
+				g.values[g.index(i, j, k)] = g.sdf(g.point(i, j, k))
+			}
+		}
+	})
+	return g
+}
+
+func (g *meshGrid) index(i, j, k int) int {
+	return i + j*g.n + k*g.n*g.n
+}
+
+func (g *meshGrid) point(i, j, k int) Vec3 {
+	return g.origin.Add(V3(float64(i)*g.step, float64(j)*g.step, float64(k)*g.step))
+}
+
+// Run fn(0..n-1) spread over all cores.
+func parallel(n int, fn func(int)) {
+	semaphore := make(chan struct{}, runtime.NumCPU())
+	var group sync.WaitGroup
+	for i := 0; i < n; i++ {
+		semaphore <- struct{}{}
+		group.Add(1)
+		go func(i int) {
+			fn(i)
+			<-semaphore
+			group.Done()
+		}(i)
+	}
+	group.Wait()
+}
+
+// Cube corner c sits at (c&1, c>>1&1, c>>2&1) within a cell.
+func cornerOffset(c int) (int, int, int) {
+	return c & 1, c >> 1 & 1, c >> 2 & 1
+}
+
+// The twelve cube edges as corner pairs, lower corner first.
+var cubeEdges [12][2]int
+
+// Triangles for each of the 256 inside/outside corner configurations,
+// as triples of cube edge indices.
+var marchingCubes [256][][3]int
+
+func init() {
+	edges := map[[2]int]int{}
+	for a := 0; a < 8; a++ {
+		for bit := 1; bit < 8; bit <<= 1 {
+			if a&bit == 0 {
+				edges[[2]int{a, a | bit}] = len(edges)
+				cubeEdges[len(edges)-1] = [2]int{a, a | bit}
+			}
+		}
+	}
+	edge := func(a, b int) int {
+		if a > b {
+			a, b = b, a
+		}
+		return edges[[2]int{a, b}]
+	}
+
+	// Faces as corner cycles, counter-clockwise seen from outside.
+	faces := [6][4]int{
+		{0, 4, 6, 2}, // -x
+		{1, 3, 7, 5}, // +x
+		{0, 1, 5, 4}, // -y
+		{2, 6, 7, 3}, // +y
+		{0, 2, 3, 1}, // -z
+		{4, 5, 7, 6}, // +z
+	}
+
+	for config := 0; config < 256; config++ {
+		inside := func(c int) bool {
+			return config&(1<<uint(c)) != 0
+		}
+
+		// Walk each face boundary and join every crossing that leaves the
+		// inside region back to the crossing that entered it. This cuts
+		// inside corners off individually on ambiguous faces, and because
+		// the rule only depends on the face itself, neighbouring cells
+		// always agree on where the surface crosses their shared face.
+		next := map[int]int{}
+		for _, face := range faces {
+			var crossings []int
+			var leaving []bool
+			for i := 0; i < 4; i++ {
+				a, b := face[i], face[(i+1)%4]
+				if inside(a) != inside(b) {
+					crossings = append(crossings, edge(a, b))
+					leaving = append(leaving, inside(a))
+				}
+			}
+			for i := range crossings {
+				if !leaving[i] {
+					continue
+				}
+				for j := 1; j < len(crossings); j++ {
+					k := (i - j + len(crossings)) % len(crossings)
+					if !leaving[k] {
+						next[crossings[i]] = crossings[k]
+						break
+					}
+				}
+			}
+		}
+
+		// Each crossing edge belongs to two faces so the segments chain
+		// into closed loops; fan-triangulate each one.
+		for len(next) > 0 {
+			start := -1
+			for e := range next {
+				if start < 0 || e < start {
+					start = e
+				}
+			}
+			loop := []int{start}
+			for e := next[start]; e != start; e = next[e] {
+				loop = append(loop, e)
+			}
+			for _, e := range loop {
+				delete(next, e)
+			}
+			for i := 1; i+1 < len(loop); i++ {
+				marchingCubes[config] = append(marchingCubes[config], [3]int{loop[0], loop[i+1], loop[i]})
+			}
+		}
+	}
+}
+
+// Polygonize an SDF3 with marching cubes. The bounding sphere is sampled
+// with resolution cells across its diameter. The mesh is watertight and
+// triangles wind counter-clockwise seen from outside.
+func MarchingCubes(sdf SDF3, resolution int) Mesh {
+	g := newMeshGrid(sdf, resolution)
+	slabs := make([][]Facet, g.n-1)
+
+	parallel(g.n-1, func(k int) {
+		var facets []Facet
+		var values [8]float64
+		var points [8]Vec3
+		for j := 0; j < g.n-1; j++ {
+			for i := 0; i < g.n-1; i++ {
+				config := 0
+				for c := 0; c < 8; c++ {
+					x, y, z := cornerOffset(c)
+					values[c] = g.values[g.index(i+x, j+y, k+z)]
+					points[c] = g.point(i+x, j+y, k+z)
+					if values[c] < 0 {
+						config |= 1 << uint(c)
+					}
+				}
+				vertex := func(e int) Vec3 {
+					a, b := cubeEdges[e][0], cubeEdges[e][1]
+					// keep vertices off the grid points so a sample that is
+					// exactly zero can't collapse several edges together
+					t := clamp(values[a]/(values[a]-values[b]), 0.001, 0.999)
+					return points[a].Add(points[b].Sub(points[a]).Scale(t))
+				}
+				for _, tri := range marchingCubes[config] {
+					facets = append(facets, Facet{vertex(tri[0]), vertex(tri[1]), vertex(tri[2])})
+				}
+			}
+		}
+		slabs[k] = facets
+	})
+
+	var mesh Mesh
+	for _, facets := range slabs {
+		mesh.Facets = append(mesh.Facets, facets...)
+	}
+	return mesh
+}
+
+// Polygonize an SDF3 with dual contouring. One vertex is placed per cell
+// by minimizing the quadratic error against the surface tangent planes,
+// which keeps sharp edges and corners that marching cubes bevels off.
+func DualContour(sdf SDF3, resolution int) Mesh {
+	g := newMeshGrid(sdf, resolution)
+	cells := g.n - 1
+	vertices := make([]Vec3, cells*cells*cells)
+
+	parallel(cells, func(k int) {
+		for j := 0; j < cells; j++ {
+			for i := 0; i < cells; i++ {
+				if v, ok := g.cellVertex(i, j, k); ok {
+					vertices[i+j*cells+k*cells*cells] = v
+				}
+			}
+		}
+	})
+
+	cell := func(i, j, k int) Vec3 {
+		return vertices[i+j*cells+k*cells*cells]
+	}
+
+	slabs := make([][]Facet, g.n)
+
+	parallel(g.n, func(k int) {
+		var facets []Facet
+		quad := func(flip bool, a, b, c, d Vec3) {
+			if flip {
+				a, b, c, d = d, c, b, a
+			}
+			facets = append(facets, Facet{a, b, c}, Facet{a, c, d})
+		}
+		for j := 0; j < g.n; j++ {
+			for i := 0; i < g.n; i++ {
+				v := g.values[g.index(i, j, k)]
+				// +x edge; quad around it in the y/z plane
+				if i+1 < g.n && j > 0 && k > 0 && j < cells && k < cells {
+					if w := g.values[g.index(i+1, j, k)]; (v < 0) != (w < 0) {
+						quad(w < 0, cell(i, j-1, k-1), cell(i, j, k-1), cell(i, j, k), cell(i, j-1, k))
+					}
+				}
+				// +y edge; quad around it in the z/x plane
+				if j+1 < g.n && k > 0 && i > 0 && k < cells && i < cells {
+					if w := g.values[g.index(i, j+1, k)]; (v < 0) != (w < 0) {
+						quad(w < 0, cell(i-1, j, k-1), cell(i-1, j, k), cell(i, j, k), cell(i, j, k-1))
+					}
+				}
+				// +z edge; quad around it in the x/y plane
+				if k+1 < g.n && i > 0 && j > 0 && i < cells && j < cells {
+					if w := g.values[g.index(i, j, k+1)]; (v < 0) != (w < 0) {
+						quad(w < 0, cell(i-1, j-1, k), cell(i, j-1, k), cell(i, j, k), cell(i-1, j, k))
+					}
+				}
+			}
+		}
+		slabs[k] = facets
+	})
+
+	var mesh Mesh
+	for _, facets := range slabs {
+		mesh.Facets = append(mesh.Facets, facets...)
+	}
+	return mesh
+}
+
+func (g *meshGrid) cellVertex(i, j, k int) (Vec3, bool) {
+	var (
+		ata  [3][3]float64
+		atb  [3]float64
+		mass Vec3
+		n    int
+	)
+
+	var points []Vec3
+	var normals []Vec3
+
+	for _, e := range cubeEdges {
+		ax, ay, az := cornerOffset(e[0])
+		bx, by, bz := cornerOffset(e[1])
+		va := g.values[g.index(i+ax, j+ay, k+az)]
+		vb := g.values[g.index(i+bx, j+by, k+bz)]
+		if (va < 0) == (vb < 0) {
+			continue
+		}
+		pa := g.point(i+ax, j+ay, k+az)
+		pb := g.point(i+bx, j+by, k+bz)
+		p := pa.Add(pb.Sub(pa).Scale(va / (va - vb)))
+		points = append(points, p)
+		normals = append(normals, SDF3Normal(g.sdf, p))
+		mass = mass.Add(p)
+		n++
+	}
+
+	if n == 0 {
+		return Zero3, false
+	}
+
+	mass = mass.Scale(1.0 / float64(n))
+
+	// Solve relative to the mass point, biased slightly toward it so
+	// flat and degenerate cells stay well conditioned.
+	for i, p := range points {
+		nv := normals[i]
+		nn := [3]float64{nv.X, nv.Y, nv.Z}
+		d := nv.Dot(p.Sub(mass))
+		for r := 0; r < 3; r++ {
+			for c := 0; c < 3; c++ {
+				ata[r][c] += nn[r] * nn[c]
+			}
+			atb[r] += nn[r] * d
+		}
+	}
+	const bias = 0.001
+	for r := 0; r < 3; r++ {
+		ata[r][r] += bias
+	}
+
+	x := solve3(ata, atb)
+	v := mass.Add(V3(x[0], x[1], x[2]))
+
+	lo := g.point(i, j, k)
+	hi := g.point(i+1, j+1, k+1)
+	return clamp3(v, lo, hi), true
+}
+
+// Solve a 3x3 linear system by Cramer's rule.
+func solve3(a [3][3]float64, b [3]float64) [3]float64 {
+	det := func(m [3][3]float64) float64 {
+		return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+			m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+			m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	}
+	d := det(a)
+	var x [3]float64
+	if abs(d) < 1e-12 {
+		return x
+	}
+	for c := 0; c < 3; c++ {
+		m := a
+		for r := 0; r < 3; r++ {
+			m[r][c] = b[r]
+		}
+		x[c] = det(m) / d
+	}
+	return x
+}
+
+// Binary STL.
+func (m Mesh) WriteSTL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 80)
+	copy(header, "spt")
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, uint32(len(m.Facets))); err != nil {
+		return err
+	}
+	for _, f := range m.Facets {
+		n := f.Normal()
+		record := [12]float32{
+			float32(n.X), float32(n.Y), float32(n.Z),
+			float32(f.A.X), float32(f.A.Y), float32(f.A.Z),
+			float32(f.B.X), float32(f.B.Y), float32(f.B.Z),
+			float32(f.C.X), float32(f.C.Y), float32(f.C.Z),
+		}
+		if err := binary.Write(bw, binary.LittleEndian, record); err != nil {
+			return err
+		}
+		if err := binary.Write(bw, binary.LittleEndian, uint16(0)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (m Mesh) WriteASCIISTL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "solid spt")
+	for _, f := range m.Facets {
+		n := f.Normal()
+		fmt.Fprintf(bw, "facet normal %g %g %g\n", n.X, n.Y, n.Z)
+		fmt.Fprintln(bw, "  outer loop")
+		for _, v := range []Vec3{f.A, f.B, f.C} {
+			fmt.Fprintf(bw, "    vertex %g %g %g\n", v.X, v.Y, v.Z)
+		}
+		fmt.Fprintln(bw, "  endloop")
+		fmt.Fprintln(bw, "endfacet")
+	}
+	fmt.Fprintln(bw, "endsolid spt")
+	return bw.Flush()
+}
+
+// Wavefront OBJ with shared vertices.
+func (m Mesh) WriteOBJ(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	index := map[Vec3]int{}
+	var faces [][3]int
+	for _, f := range m.Facets {
+		var face [3]int
+		for i, v := range []Vec3{f.A, f.B, f.C} {
+			id, ok := index[v]
+			if !ok {
+				id = len(index) + 1
+				index[v] = id
+				fmt.Fprintf(bw, "v %g %g %g\n", v.X, v.Y, v.Z)
+			}
+			face[i] = id
+		}
+		faces = append(faces, face)
+	}
+	for _, face := range faces {
+		fmt.Fprintf(bw, "f %d %d %d\n", face[0], face[1], face[2])
+	}
+	return bw.Flush()
+}
+
+// Save a mesh as binary STL or OBJ depending on the file extension.
+func SaveMesh(m Mesh, path string) error {
+	var write func(io.Writer) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".obj":
+		write = m.WriteOBJ
+	case ".stl":
+		write = m.WriteSTL
+	default:
+		return fmt.Errorf("unknown mesh format: %s", path)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Read an STL file, binary or ASCII.
+func ReadSTL(r io.Reader) (Mesh, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Mesh{}, err
+	}
+	// ASCII files start with "solid", but so do some binary headers, so
+	// trust the binary size calculation first
+	if len(data) >= 84 {
+		n := binary.LittleEndian.Uint32(data[80:84])
+		if uint64(len(data)) == 84+50*uint64(n) {
+			return readBinarySTL(data[84:], int(n))
+		}
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		return readASCIISTL(data)
+	}
+	return Mesh{}, fmt.Errorf("stl: not a binary or ASCII STL file")
+}
+
+func readBinarySTL(data []byte, n int) (Mesh, error) {
+	var mesh Mesh
+	record := make([]float32, 12)
+	buf := bytes.NewReader(data)
+	for i := 0; i < n; i++ {
+		if err := binary.Read(buf, binary.LittleEndian, record); err != nil {
+			return Mesh{}, fmt.Errorf("stl: facet %d: %v", i, err)
+		}
+		var attr uint16
+		if err := binary.Read(buf, binary.LittleEndian, &attr); err != nil {
+			return Mesh{}, fmt.Errorf("stl: facet %d: %v", i, err)
+		}
+		v := func(j int) Vec3 {
+			return V3(float64(record[j]), float64(record[j+1]), float64(record[j+2]))
+		}
+		mesh.Facets = append(mesh.Facets, Facet{v(3), v(6), v(9)})
+	}
+	return mesh, nil
+}
+
+func readASCIISTL(data []byte) (Mesh, error) {
+	var mesh Mesh
+	var vertices []Vec3
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "vertex" {
+			continue
+		}
+		v, err := parseVec3(fields[1:])
+		if err != nil {
+			return Mesh{}, fmt.Errorf("stl: line %d: %v", line, err)
+		}
+		vertices = append(vertices, v)
+		if len(vertices) == 3 {
+			mesh.Facets = append(mesh.Facets, Facet{vertices[0], vertices[1], vertices[2]})
+			vertices = vertices[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Mesh{}, err
+	}
+	if len(vertices) > 0 {
+		return Mesh{}, fmt.Errorf("stl: incomplete facet at end of file")
+	}
+	return mesh, nil
+}
+
+// Read a Wavefront OBJ file. Polygons are fan triangulated; texture and
+// normal indices are ignored.
+func ReadOBJ(r io.Reader) (Mesh, error) {
+	var mesh Mesh
+	var vertices []Vec3
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "v":
+			v, err := parseVec3(fields[1:])
+			if err != nil {
+				return Mesh{}, fmt.Errorf("obj: line %d: %v", line, err)
+			}
+			vertices = append(vertices, v)
+		case "f":
+			var face []Vec3
+			for _, field := range fields[1:] {
+				id, err := strconv.Atoi(strings.SplitN(field, "/", 2)[0])
+				if err != nil {
+					return Mesh{}, fmt.Errorf("obj: line %d: %v", line, err)
+				}
+				// negative indices count back from the latest vertex
+				if id < 0 {
+					id += len(vertices) + 1
+				}
+				if id < 1 || id > len(vertices) {
+					return Mesh{}, fmt.Errorf("obj: line %d: vertex %s out of range", line, field)
+				}
+				face = append(face, vertices[id-1])
+			}
+			if len(face) < 3 {
+				return Mesh{}, fmt.Errorf("obj: line %d: face needs at least 3 vertices", line)
+			}
+			for i := 1; i+1 < len(face); i++ {
+				mesh.Facets = append(mesh.Facets, Facet{face[0], face[i], face[i+1]})
+			}
+		}
+	}
+	return mesh, scanner.Err()
+}
+
+func parseVec3(fields []string) (Vec3, error) {
+	if len(fields) < 3 {
+		return Zero3, fmt.Errorf("expected 3 coordinates, got %d", len(fields))
+	}
+	var xyz [3]float64
+	for i := range xyz {
+		f, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return Zero3, err
+		}
+		xyz[i] = f
+	}
+	return V3(xyz[0], xyz[1], xyz[2]), nil
+}
+
+// Load an STL or OBJ file depending on the file extension.
+func LoadMesh(path string) (Mesh, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Mesh{}, err
+	}
+	defer file.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".obj":
+		return ReadOBJ(file)
+	case ".stl":
+		return ReadSTL(file)
+	}
+	return Mesh{}, fmt.Errorf("unknown mesh format: %s", path)
+}
@@ -0,0 +1,115 @@
+package spt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Every directed edge must be matched by exactly one opposite edge for a
+// closed, consistently wound surface.
+func meshCheck(t *testing.T, name string, mesh Mesh, sdf SDF3) {
+	if len(mesh.Facets) == 0 {
+		t.Fatalf("%s: empty mesh", name)
+	}
+	edges := map[[2]Vec3]int{}
+	for _, f := range mesh.Facets {
+		edges[[2]Vec3{f.A, f.B}]++
+		edges[[2]Vec3{f.B, f.C}]++
+		edges[[2]Vec3{f.C, f.A}]++
+	}
+	for e, n := range edges {
+		if n != 1 || edges[[2]Vec3{e[1], e[0]}] != 1 {
+			t.Fatalf("%s: not watertight at %v", name, e)
+		}
+	}
+	f := sdf.SDF()
+	outward := 0
+	for _, facet := range mesh.Facets {
+		n := facet.Normal()
+		c := facet.A.Add(facet.B).Add(facet.C).Scale(1.0 / 3)
+		if SDF3Normal(f, c).Dot(n) > 0 {
+			outward++
+		}
+	}
+	if outward < len(mesh.Facets)*99/100 {
+		t.Errorf("%s: only %d of %d facets face outward", name, outward, len(mesh.Facets))
+	}
+}
+
+func TestMarchingCubes(t *testing.T) {
+	for _, sdf := range []SDF3{
+		Sphere(500),
+		Union(Cube(800, 800, 800), TranslateX(400, Sphere(300))),
+		Difference(Sphere(500), Cylinder(1200, 200)),
+	} {
+		meshCheck(t, "marching cubes", MarchingCubes(sdf, 24), sdf)
+	}
+}
+
+func TestDualContour(t *testing.T) {
+	sdf := Cube(800, 800, 800)
+	mesh := DualContour(sdf, 24)
+	meshCheck(t, "dual contour", mesh, sdf)
+
+	// sharp corners survive
+	corner := false
+	for _, f := range mesh.Facets {
+		for _, v := range []Vec3{f.A, f.B, f.C} {
+			if v.Sub(V3(400, 400, 400)).Length() < 1 {
+				corner = true
+			}
+		}
+	}
+	if !corner {
+		t.Errorf("dual contour lost the cube corner")
+	}
+}
+
+func TestMeshWriters(t *testing.T) {
+	mesh := MarchingCubes(Sphere(100), 8)
+
+	buf := new(bytes.Buffer)
+	if err := mesh.WriteSTL(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 84+50*len(mesh.Facets) {
+		t.Errorf("binary STL is %d bytes for %d facets", buf.Len(), len(mesh.Facets))
+	}
+
+	buf.Reset()
+	if err := mesh.WriteASCIISTL(buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "facet normal"); n != len(mesh.Facets) {
+		t.Errorf("ASCII STL has %d facets, want %d", n, len(mesh.Facets))
+	}
+
+	buf.Reset()
+	if err := mesh.WriteOBJ(buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\nf "); n != len(mesh.Facets) {
+		t.Errorf("OBJ has %d faces, want %d", n, len(mesh.Facets))
+	}
+
+	// an unknown format leaves the file alone
+	dir, err := ioutil.TempDir("", "spt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mesh.txt")
+	if err := ioutil.WriteFile(path, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveMesh(mesh, path); err == nil {
+		t.Error("saved an unknown format")
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "keep" {
+		t.Errorf("unknown format wrote %q, %v", data, err)
+	}
+}
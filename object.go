@@ -6,10 +6,13 @@ type Thing struct {
 	sdf    func(Vec3) float64
 	center Vec3
 	radius float64
+	lo, hi Vec3
+	// set by Scene.prepare, for the ID AOVs
+	index, material int32
 }
 
 func Object(mat Material, sdf SDF3) Thing {
-	return Thing{mat, sdf, nil, Zero3, 0.0}
+	return Thing{Mat: mat, SDF3: sdf}
 }
 
 func (o *Thing) Material() Material {
@@ -27,6 +30,7 @@ func (o *Thing) Distance(pos Vec3) float64 {
 func (o *Thing) Prepare() {
 	o.sdf = o.SDF3.SDF()
 	o.center, o.radius = o.SDF3.Sphere()
+	o.lo, o.hi = Bounds(o.SDF3)
 }
 
 func (o *Thing) SDF() func(Vec3) float64 {
@@ -37,6 +41,10 @@ func (o *Thing) Sphere() (Vec3, float64) {
 	return o.center, o.radius
 }
 
+func (o *Thing) Bounds() (Vec3, Vec3) {
+	return o.lo, o.hi
+}
+
 func (o *Thing) BoundingDistance(pos Vec3) float64 {
-	return (sphere{o.center, o.radius}).distance(pos)
+	return (bound{sphere{o.center, o.radius}, o.lo, o.hi}).distance(pos)
 }
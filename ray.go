@@ -17,6 +17,11 @@ type Hit struct {
 }
 
 func (r Ray) PathTrace(scene *Scene, depth int, bypass *Thing) (Color, int, float64) {
+	return r.pathTrace(scene, depth, bypass, nil)
+}
+
+// PathTrace, adding the AOVs of a primary hit to aov when it is set.
+func (r Ray) pathTrace(scene *Scene, depth int, bypass *Thing, aov *Pixel) (Color, int, float64) {
 
 	var (
 		shadow      Ray
@@ -34,6 +39,16 @@ func (r Ray) PathTrace(scene *Scene, depth int, bypass *Thing) (Color, int, floa
 	if thing, hit := r.march(scene, bypass); thing != nil {
 		_, invisible = thing.Material().(Invisible)
 
+		if aov != nil {
+			aov.Depth += hit.Sub(r.Origin).Length()
+			aov.Normal = aov.Normal.Add(thing.Normal(hit))
+			aov.Albedo = aov.Albedo.Add(albedo(thing.Material()))
+			aov.Hits++
+			if aov.Object == 0 {
+				aov.Object, aov.Material = thing.index+1, thing.material+1
+			}
+		}
+
 		if depth == 0 && invisible {
 			alpha = scene.ShadowH
 			if r.directLight(scene, hit).Brightness() > 0.0 {
@@ -98,31 +113,29 @@ func (r Ray) march(scene *Scene, bypass *Thing) (*Thing, Vec3) {
 	// shadow acne
 	pos = pos.Add(r.Direction.Scale(scene.Threshold * 10))
 
-	// find all possible targets
+	if scene.tree != nil {
+		nodes := scene.tree.cull(r, scene.Threshold)
+		defer scene.tree.release(nodes)
+		if len(nodes) > 0 {
+			for pos.Sub(r.Origin).Length() < scene.Horizon {
+				near, dist := nearestThing(nodes, pos)
+				if dist < scene.Threshold {
+					return near, pos
+				}
+				pos = pos.Add(r.Direction.Scale(dist))
+			}
+		}
+		return nil, Z3
+	}
+
+	// without a tree, test every object, culling as the tree does
 	var targets []*Thing
+	inv := V3(1/r.Direction.X, 1/r.Direction.Y, 1/r.Direction.Z)
 	for i := range scene.Stuff {
 		t := &scene.Stuff[i]
-		center, radius := t.Sphere()
-
-		// since objects have a bounding sphere, behave like a non-SDF
-		// ray tracer and do a line-sphere intersection test to quickly
-		// rule them in or out
-		to := r.Origin.Sub(center)
-		b := to.Dot(r.Direction)
-		c := to.Dot(to) - radius*radius
-		d := b*b - c
-		if d > 0 {
-			d = sqrt(d)
-			t1 := -b - d
-			if t1 > scene.Threshold {
-				targets = append(targets, t)
-				continue
-			}
-			t2 := -b + d
-			if t2 > scene.Threshold {
-				targets = append(targets, t)
-				continue
-			}
+		lo, hi := thingBox(t)
+		if r.hitsBox(lo, hi, inv, scene.Threshold) && r.hitsSphere(t, scene.Threshold) {
+			targets = append(targets, t)
 		}
 	}
 
@@ -163,8 +176,8 @@ func (r Ray) march(scene *Scene, bypass *Thing) (*Thing, Vec3) {
 // direct sample all lights
 func (r Ray) directLight(scene *Scene, pos Vec3) Color {
 	var color Color
-	for i := range scene.Stuff {
-		t := &scene.Stuff[i]
+	lights := scene.lights()
+	for _, t := range lights {
 		if light, is := t.Material().Light(); is {
 			center, radius := t.Sphere()
 			center = center.Add(pickVec3(r.rnd).Scale(radius * scene.ShadowR))
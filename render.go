@@ -3,11 +3,15 @@ package spt
 import (
 	"bytes"
 	"compress/flate"
+	"context"
 	"encoding/binary"
+	"fmt"
 	"image"
+	"io"
 	"log"
 	"net/rpc"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,6 +19,12 @@ type Renderer interface {
 	Render(Scene) (Raster, error)
 }
 
+// Renderers that can be cancelled, and report rows as they finish.
+type ContextRenderer interface {
+	Renderer
+	RenderContext(ctx context.Context, scene Scene, row func(rays int)) (Raster, error)
+}
+
 func RenderSave(out string, scene Scene, renderers []Renderer) {
 	for pass := range Render(scene, renderers) {
 		SavePNG(pass, out)
@@ -22,63 +32,447 @@ func RenderSave(out string, scene Scene, renderers []Renderer) {
 }
 
 func Render(scene Scene, renderers []Renderer) chan image.Image {
+	return RenderContext(context.Background(), scene, renderers, RenderOptions{})
+}
 
-	if len(renderers) == 0 {
-		renderers = []Renderer{NewLocalRenderer()}
+type RenderOptions struct {
+	Deadline time.Time      // Optional wall-clock limit
+	Progress func(Progress) // Optional, never called concurrently
+	TileSize int            // Optional tile edge in pixels
+	Farm     *Farm          // Optional workers that come and go
+	Denoise  *Denoiser      // Optional, denoises frames and turns on Scene.AOV to guide it
+
+	Checkpoint      string        // Optional file the raw render is kept in, to resume or merge
+	CheckpointEvery time.Duration // Optional, a minute by default; checkpoints are also saved at the end
+}
+
+// default time between checkpoints
+const checkpointEvery = time.Minute
+
+const (
+	// backoff between retries of a failing renderer
+	retryMin = time.Second
+	retryMax = time.Minute
+)
+
+func backoff(wait time.Duration) time.Duration {
+	if wait *= 2; wait > retryMax {
+		wait = retryMax
 	}
+	return wait
+}
 
-	rasters := make(chan Raster, len(renderers))
-	jobs := make(chan struct{}, len(renderers)*2)
-	ready := make(chan Renderer, len(renderers))
+// A progress event, sent as tiles finish and as each pass is merged.
+type Progress struct {
+	Pass       int   // pass the event is about
+	Passes     int   // Scene.Passes, or 0 when unlimited
+	Rows       int   // rows' worth of Pass merged so far
+	Height     int   // rows per pass
+	Merged     int   // passes merged into the image so far
+	Rays       int64 // rays traced for the tiles finished so far, once each however many workers raced for them
+	Elapsed    time.Duration
+	RaysPerSec float64
+}
 
-	for _, r := range renderers {
-		ready <- r
+type progress struct {
+	sync.Mutex
+	report func(Progress)
+	start  time.Time
+	width  int
+	pixels map[int]int
+	event  Progress
+}
+
+func (p *progress) send(pass int) {
+	p.event.Pass = pass
+	p.event.Rows = p.pixels[pass] / p.width
+	p.event.Elapsed = time.Since(p.start)
+	p.event.RaysPerSec = float64(p.event.Rays) / p.event.Elapsed.Seconds()
+	p.report(p.event)
+}
+
+func (p *progress) tile(pass int, region image.Rectangle, rays int64) {
+	if p.report == nil {
+		return
 	}
+	p.Lock()
+	defer p.Unlock()
+	p.event.Rays += rays
+	p.pixels[pass] += region.Dx() * region.Dy()
+	p.send(pass)
+}
 
-	var group sync.WaitGroup
+func (p *progress) merged(pass int) {
+	if p.report == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.event.Merged++
+	p.send(pass)
+	delete(p.pixels, pass)
+}
 
-	group.Add(1)
-	go func(scene Scene) {
-		for range jobs {
-			renderer := <-ready
-			go func() {
-				raster, err := renderer.Render(scene)
-				if err == nil {
-					ready <- renderer
-					rasters <- raster
-				} else {
-					log.Println("renderer", renderer, err)
-					jobs <- struct{}{}
-					time.Sleep(5 * time.Second)
-					ready <- renderer
-				}
-			}()
+// Render a tile with any renderer. Those that don't know about tiles
+// render the whole frame with samples only in the tile's region, and
+// unless they're ContextRenderers are abandoned to finish in the
+// background if cancelled.
+func renderTile(ctx context.Context, renderer Renderer, scene Scene, tile Tile, row func(rays int)) (Raster, error) {
+	if r, ok := renderer.(TileRenderer); ok {
+		return r.RenderTile(ctx, scene, tile, row)
+	}
+
+	// budgets hold no more than MaxSamples, and would wrap
+	if tile.Samples > MaxSamples {
+		return nil, fmt.Errorf("%d samples per pixel; renderers without tiles take at most %d", tile.Samples, MaxSamples)
+	}
+
+	// the pass's own numbers, as the tile renderers would use
+	region := tile.Region
+	scene.Pass = tile.Pass
+	scene.Budget = make([]uint16, scene.Width*scene.Height)
+	if tile.Taken != nil {
+		scene.Taken = make([]uint32, scene.Width*scene.Height)
+	}
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			i := (y-region.Min.Y)*region.Dx() + (x - region.Min.X)
+			samples := uint16(tile.Samples)
+			if tile.Budget != nil {
+				samples = tile.Budget[i]
+			}
+			scene.Budget[y*scene.Width+x] = samples
+			if tile.Taken != nil {
+				scene.Taken[y*scene.Width+x] = tile.Taken[i]
+			}
 		}
-		group.Done()
-	}(scene)
+	}
 
-	scene.Raster = make(Raster, scene.Width*scene.Height)
+	// only the tile's part of the frame is kept
+	crop := func(frame Raster) Raster {
+		bounds := scene.splatBounds(region)
+		raster := make(Raster, 0, bounds.Dx()*bounds.Dy())
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			raster = append(raster, frame[y*scene.Width+bounds.Min.X:y*scene.Width+bounds.Max.X]...)
+		}
+		return raster
+	}
 
-	group.Add(1)
+	if r, ok := renderer.(ContextRenderer); ok {
+		frame, err := r.RenderContext(ctx, scene, row)
+		if err != nil {
+			return nil, err
+		}
+		return crop(frame), nil
+	}
+
+	type result struct {
+		raster Raster
+		err    error
+	}
+	done := make(chan result, 1)
 	go func() {
-		for pass := 1; pass <= scene.Passes || scene.Passes == 0; pass++ {
-			jobs <- struct{}{}
+		raster, err := renderer.Render(scene)
+		done <- result{raster, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		raster := crop(r.raster)
+		scene.rowRays(region, raster, row)
+		return raster, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// report the rows of a tile's raster at once, for renderers that can't
+// report them as they go
+func (scene *Scene) rowRays(region image.Rectangle, raster Raster, row func(rays int)) {
+	if row == nil {
+		return
+	}
+	bounds := scene.splatBounds(region)
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		rays := 0
+		for x := region.Min.X; x < region.Max.X; x++ {
+			rays += int(raster[(y-bounds.Min.Y)*bounds.Dx()+(x-bounds.Min.X)].Rays)
 		}
-		group.Done()
+		row(rays)
+	}
+}
+
+// Render passes in the background, sending the merged image after each.
+// Passes are split into tiles shared out among the renderers, the next
+// pass starting while the last tiles of the previous one finish.
+// The channel closes after Scene.Passes passes, once every pixel is below
+// Scene.Noise, or when ctx is done or the deadline passes, by which time
+// all local rendering has stopped and in-flight RPC calls have been
+// abandoned.
+func RenderContext(ctx context.Context, scene Scene, renderers []Renderer, opts RenderOptions) chan image.Image {
+	return renderFrom(ctx, scene, renderers, opts, nil)
+}
+
+// RenderContext, starting from a checkpoint's raster when there is one
+func renderFrom(ctx context.Context, scene Scene, renderers []Renderer, opts RenderOptions, resume *Checkpoint) chan image.Image {
+
+	if len(renderers) == 0 && opts.Farm == nil {
+		renderers = []Renderer{NewLocalRenderer()}
+	}
+
+	var cancel context.CancelFunc
+	if opts.Deadline.IsZero() {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithDeadline(ctx, opts.Deadline)
+	}
+
+	track := &progress{
+		report: opts.Progress,
+		start:  time.Now(),
+		width:  scene.Width,
+		pixels: map[int]int{},
+		event:  Progress{Passes: scene.Passes, Height: scene.Height},
+	}
+
+	if opts.Denoise != nil {
+		scene.AOV = true
+	}
+	// one seed for every worker, kept in the frames so the render can be
+	// repeated
+	if scene.Seed == 0 {
+		scene.Seed = time.Now().UTC().UnixNano()
+	}
+
+	// workers get the scene as it was, not the one being merged into,
+	// prepared once for all the local renderers to share
+	job := scene
+	job.Stuff = append([]Thing(nil), job.Stuff...)
+	job.prepare()
+	scene.Raster = make(Raster, scene.Width*scene.Height)
+
+	// passes in the raster so far, by the seed they were rendered with
+	done := map[int64]int{}
+	if resume != nil {
+		copy(scene.Raster, resume.Scene.Raster)
+		for seed, passes := range resume.Passes {
+			done[seed] = passes
+		}
+	}
+	first := done[scene.Seed] + 1
+
+	tiles := newTileScheduler(scene, opts.TileSize, first)
+	if first > 1 && (scene.Adaptive || scene.Noise > 0) {
+		plan, _ := scene.plan()
+		tiles.plan(first-1, plan)
+	}
+	go func() {
+		<-ctx.Done()
+		tiles.stop()
 	}()
 
+	type result struct {
+		work   *tileWork
+		raster Raster
+		rays   int64
+	}
+	results := make(chan result, len(renderers))
+
+	var group sync.WaitGroup
+
+	// Each worker renders tiles until wctx is done, which is ctx unless it
+	// belongs to a farm member that may leave.
+	worker := func(wctx context.Context, renderer Renderer) {
+		defer group.Done()
+		wait := retryMin
+		for {
+			work, tctx := tiles.take(wctx)
+			if work == nil {
+				return
+			}
+			// only the copy of a tile that's merged counts its rays
+			var rays int64
+			raster, err := renderTile(tctx, renderer, job, work.tile, func(n int) {
+				atomic.AddInt64(&rays, int64(n))
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			if wctx.Err() != nil {
+				tiles.fail(work) // left the farm, so hand the tile on
+				return
+			}
+			if tctx.Err() != nil {
+				continue // stolen, and finished elsewhere
+			}
+			if err != nil {
+				log.Println("renderer", renderer, err, "retry in", wait)
+				tiles.fail(work)
+				select {
+				case <-time.After(wait):
+				case <-wctx.Done():
+					return
+				}
+				wait = backoff(wait)
+				continue
+			}
+			wait = retryMin
+			if !tiles.finish(work) {
+				continue
+			}
+
+			select {
+			case results <- result{work, raster, atomic.LoadInt64(&rays)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	for _, r := range renderers {
+		group.Add(1)
+		go worker(ctx, r)
+	}
+
+	if opts.Farm != nil {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			// farm members working on this render, and how to stop them
+			working := map[*farmWorker]context.CancelFunc{}
+			defer func() {
+				for _, stop := range working {
+					stop()
+				}
+			}()
+
+			poll := time.NewTicker(farmPoll)
+			defer poll.Stop()
+
+			for {
+				members := map[*farmWorker]bool{}
+				for _, w := range opts.Farm.members() {
+					members[w] = true
+					if _, ok := working[w]; !ok {
+						wctx, stop := context.WithCancel(ctx)
+						working[w] = stop
+						for i := 0; i < w.slots(opts.TileSize); i++ {
+							group.Add(1)
+							go worker(wctx, w.renderer)
+						}
+					}
+				}
+				for w, stop := range working {
+					if !members[w] {
+						stop()
+						delete(working, w)
+						tiles.wake()
+					}
+				}
+
+				select {
+				case <-poll.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
 	frames := make(chan image.Image, 1)
 
+	every := opts.CheckpointEvery
+	if every <= 0 {
+		every = checkpointEvery
+	}
+	saved, unsaved := time.Now(), false
+	checkpoint := func() {
+		saved, unsaved = time.Now(), false
+		if err := SaveCheckpoint(opts.Checkpoint, &Checkpoint{Scene: scene, Passes: done}); err != nil {
+			log.Println("checkpoint", err)
+		}
+	}
+
 	go func() {
-		for pass := 1; pass <= scene.Passes || scene.Passes == 0; pass++ {
-			log.Println("pass", pass, "of", scene.Passes)
-			scene.Merge(<-rasters)
-			copy := scene
-			frames <- &copy
+		defer func() {
+			cancel()
+			group.Wait()
+			if unsaved {
+				checkpoint()
+			}
+			close(frames)
+		}()
+
+		// Tiles are merged a pass at a time, in order, so the sums are the
+		// same however they were shared out and whenever they finished.
+		pending := map[int][]Raster{}
+		left := map[int]int{}
+		for merged := first; merged <= scene.Passes || scene.Passes == 0; {
+			if left[merged] < len(tiles.regions) {
+				var r result
+				select {
+				case r = <-results:
+				case <-ctx.Done():
+					return
+				}
+
+				pass := r.work.tile.Pass
+				if pending[pass] == nil {
+					pending[pass] = make([]Raster, len(tiles.regions))
+				}
+				pending[pass][r.work.region] = r.raster
+				left[pass]++
+				track.tile(pass, r.work.tile.Region, r.rays)
+				continue
+			}
+
+			for i, raster := range pending[merged] {
+				scene.MergeTile(tiles.regions[i], raster)
+			}
+			delete(pending, merged)
+			delete(left, merged)
+
+			done[scene.Seed] = merged
+			if opts.Checkpoint != "" {
+				unsaved = true
+				if time.Since(saved) >= every {
+					checkpoint()
+				}
+			}
+
+			log.Println("pass", merged, "of", scene.Passes)
+			track.merged(merged)
+
+			converged := false
+			if scene.Adaptive || scene.Noise > 0 {
+				var plan []uint16
+				plan, converged = scene.plan()
+				tiles.plan(merged, plan)
+			}
+
+			// frames outlive the pass, so they get their own raster
+			var frame *Scene
+			if opts.Denoise != nil {
+				frame = opts.Denoise.Denoise(&scene)
+			} else {
+				copy := scene
+				copy.Raster = append(Raster(nil), scene.Raster...)
+				frame = &copy
+			}
+			select {
+			case frames <- frame:
+			case <-ctx.Done():
+				return
+			}
+			if converged {
+				log.Println("converged after", merged, "passes")
+				return
+			}
+			merged++
 		}
-		close(jobs)
-		group.Wait()
-		close(frames)
 	}()
 
 	return frames
@@ -91,37 +485,186 @@ func (r LocalRenderer) Render(scene Scene) (Raster, error) {
 	return raster, nil
 }
 
+func (r LocalRenderer) RenderContext(ctx context.Context, scene Scene, row func(rays int)) (Raster, error) {
+	return scene.RenderContext(ctx, row)
+}
+
+func (r LocalRenderer) RenderTile(ctx context.Context, scene Scene, tile Tile, row func(rays int)) (Raster, error) {
+	return scene.RenderTile(ctx, tile, row)
+}
+
 func NewLocalRenderer() Renderer {
 	return LocalRenderer{}
 }
 
 type RPCRenderer struct {
 	addr string
+	link *rpcLink
+}
+
+// A connection to a worker, kept open across tiles and passes and shared
+// by copies of the RPCRenderer, plus what the worker has cached.
+type rpcLink struct {
+	sync.Mutex
+	transport Transport
+	client    *rpc.Client
+	uploaded  map[string]bool
+	// the last Stuff encoded, so every tile doesn't encode it again
+	stuff []Thing
+	hash  string
+	blob  []byte
 }
 
 func NewRPCRenderer(address string) Renderer {
-	return RPCRenderer{address}
+	return NewRPCRendererWith(address, Transport{})
+}
+
+// An RPCRenderer for a worker started with RenderServeRPCWith.
+func NewRPCRendererWith(address string, transport Transport) Renderer {
+	return RPCRenderer{address, &rpcLink{transport: transport, uploaded: map[string]bool{}}}
+}
+
+func (l *rpcLink) connect(ctx context.Context, addr string) (*rpc.Client, error) {
+	l.Lock()
+	defer l.Unlock()
+	if l.client == nil {
+		conn, err := l.transport.dial(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		l.client = rpc.NewClient(conn)
+	}
+	return l.client, nil
+}
+
+// forget a broken connection, and what the worker at the other end had
+func (l *rpcLink) drop(client *rpc.Client) {
+	l.Lock()
+	defer l.Unlock()
+	if l.client == client {
+		l.client.Close()
+		l.client = nil
+		l.uploaded = map[string]bool{}
+	}
+}
+
+// Stuff is encoded once per slice, so it mustn't change between calls
+func (l *rpcLink) encode(stuff []Thing) (string, []byte, error) {
+	l.Lock()
+	defer l.Unlock()
+	same := len(stuff) == len(l.stuff) && (len(stuff) == 0 || &stuff[0] == &l.stuff[0])
+	if !same || l.blob == nil {
+		hash, blob, err := encodeStuff(stuff)
+		if err != nil {
+			return "", nil, err
+		}
+		l.stuff, l.hash, l.blob = stuff, hash, blob
+	}
+	return l.hash, l.blob, nil
+}
+
+func (l *rpcLink) has(hash string) bool {
+	l.Lock()
+	defer l.Unlock()
+	return l.uploaded[hash]
+}
+
+func (l *rpcLink) mark(hash string, cached bool) {
+	l.Lock()
+	defer l.Unlock()
+	l.uploaded[hash] = cached
+}
+
+// Close the connection to the worker.
+func (r RPCRenderer) Close() error {
+	r.link.Lock()
+	defer r.link.Unlock()
+	if r.link.client == nil {
+		return nil
+	}
+	err := r.link.client.Close()
+	r.link.client = nil
+	r.link.uploaded = map[string]bool{}
+	return err
 }
 
 func (r RPCRenderer) Render(scene Scene) (Raster, error) {
+	return r.RenderContext(context.Background(), scene, nil)
+}
 
-	var (
-		slave  *rpc.Client
-		cr     CompressedRaster
-		raster Raster
-		err    error
-	)
+func (r RPCRenderer) RenderContext(ctx context.Context, scene Scene, row func(rays int)) (Raster, error) {
+	return r.RenderTile(ctx, scene, Tile{
+		Pass:    scene.Pass,
+		Region:  scene.Bounds(),
+		Samples: scene.Samples,
+		Budget:  scene.Budget,
+		Taken:   scene.Taken,
+	}, row)
+}
+
+// Cancelling abandons the call. The worker finishes the tile regardless,
+// but nobody waits for it.
+func (r RPCRenderer) call(ctx context.Context, client *rpc.Client, method string, args, reply interface{}) error {
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if _, ok := call.Error.(rpc.ServerError); call.Error != nil && !ok {
+			r.link.drop(client)
+		}
+		return call.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	if slave, err = rpc.Dial("tcp", r.addr); err == nil {
-		defer slave.Close()
-		err = slave.Call("RenderRPC.Render", scene, &cr)
+// The scene's Stuff goes to the worker once, then is referred to by hash.
+func (r RPCRenderer) RenderTile(ctx context.Context, scene Scene, tile Tile, row func(rays int)) (Raster, error) {
 
-		if err == nil {
-			raster = make(Raster, scene.Width*scene.Height)
-			fr := flate.NewReader(bytes.NewReader(cr.Buf))
-			binary.Read(fr, binary.LittleEndian, raster)
+	client, err := r.link.connect(ctx, r.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, blob, err := r.link.encode(scene.Stuff)
+	if err != nil {
+		return nil, err
+	}
+	scene.Stuff = nil
+	scene.Raster = nil
+	scene.Budget = nil
+	scene.Taken = nil
+
+	var cr CompressedRaster
+	for attempt := 0; attempt < 2; attempt++ {
+		if !r.link.has(hash) {
+			var ok bool
+			if err = r.call(ctx, client, "RenderRPC.Upload", SceneUpload{hash, blob}, &ok); err != nil {
+				return nil, err
+			}
+			r.link.mark(hash, true)
+		}
+		err = r.call(ctx, client, "RenderRPC.RenderCached", CachedTileJob{hash, scene, tile}, &cr)
+		// evicted, or the worker restarted
+		if err != nil && err.Error() == errSceneUnknown.Error() {
+			r.link.mark(hash, false)
+			continue
 		}
+		break
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return raster, err
+	bounds := scene.splatBounds(tile.Region)
+	raster := make(Raster, bounds.Dx()*bounds.Dy())
+	fr := flate.NewReader(bytes.NewReader(cr.Buf))
+	if err := binary.Read(fr, binary.LittleEndian, raster); err != nil {
+		return nil, fmt.Errorf("tile %v from %s: %v", tile.Region, r.addr, err)
+	}
+	// a raster for some other region would splat into the wrong pixels
+	if _, err := io.ReadFull(fr, make([]byte, 1)); err != io.EOF {
+		return nil, fmt.Errorf("tile %v from %s: raster larger than %v", tile.Region, r.addr, bounds)
+	}
+	scene.rowRays(tile.Region, raster, row)
+	return raster, nil
 }
@@ -0,0 +1,193 @@
+package spt
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"image"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+func tinyScene() Scene {
+	return Scene{
+		Width:     32,
+		Height:    18,
+		Passes:    0,
+		Samples:   1,
+		Bounces:   2,
+		Horizon:   100000,
+		Threshold: 0.0001,
+		Ambient:   White.Scale(0.05),
+		Camera:    NewCamera(V3(0, -3000, 3000), V3(0, 0, 0), Z3, 40, Zero3, 0.0),
+		Stuff: []Thing{
+			Object(Light(White.Scale(4)), Translate(V3(-7500, 0, 20000), Sphere(10000))),
+			Object(Steel, Sphere(500)),
+		},
+	}
+}
+
+func TestRenderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	frames := RenderContext(ctx, tinyScene(), nil, RenderOptions{})
+
+	<-frames
+	<-frames
+	cancel()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-frames:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("render still running after cancel")
+		}
+	}
+}
+
+func TestRenderDeadline(t *testing.T) {
+	start := time.Now()
+	frames := RenderContext(context.Background(), tinyScene(), nil, RenderOptions{
+		Deadline: start.Add(500 * time.Millisecond),
+	})
+
+	n := 0
+	for range frames {
+		n++
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("deadline ignored, ran for %v", elapsed)
+	}
+	if n == 0 {
+		t.Errorf("no frames before the deadline")
+	}
+}
+
+func TestRenderProgress(t *testing.T) {
+	scene := tinyScene()
+	scene.Passes = 3
+
+	var events []Progress
+	for range RenderContext(context.Background(), scene, []Renderer{NewLocalRenderer(), NewLocalRenderer()}, RenderOptions{
+		Progress: func(p Progress) { events = append(events, p) },
+	}) {
+	}
+
+	rows := map[int]int{}
+	var rays int64
+	for _, e := range events {
+		if e.Rays < rays {
+			t.Fatalf("rays went backwards: %d after %d", e.Rays, rays)
+		}
+		rays = e.Rays
+		rows[e.Pass] = e.Rows
+	}
+
+	last := events[len(events)-1]
+	if last.Merged != 3 || last.Passes != 3 || last.Height != scene.Height {
+		t.Errorf("last event %+v", last)
+	}
+	if want := int64(3 * scene.Width * scene.Height * scene.Samples); last.Rays != want {
+		t.Errorf("%d rays, want %d", last.Rays, want)
+	}
+	if last.RaysPerSec <= 0 {
+		t.Errorf("rays/sec %v", last.RaysPerSec)
+	}
+	for pass := 1; pass <= 3; pass++ {
+		if rows[pass] != scene.Height {
+			t.Errorf("pass %d finished %d rows of %d", pass, rows[pass], scene.Height)
+		}
+	}
+}
+
+func TestRPCRendererCancel(t *testing.T) {
+	// a worker that accepts connections and never answers
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listen.Close()
+	go func() {
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	renderer := NewRPCRenderer(listen.Addr().String()).(ContextRenderer)
+	if _, err := renderer.RenderContext(ctx, tinyScene(), nil); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("call not abandoned, took %v", elapsed)
+	}
+
+	// the whole render stops too
+	frames := RenderContext(context.Background(), tinyScene(), []Renderer{NewRPCRenderer(listen.Addr().String())}, RenderOptions{
+		Deadline: time.Now().Add(200 * time.Millisecond),
+	})
+	for range frames {
+		t.Errorf("frame from a silent worker")
+	}
+}
+
+// a worker that answers tiles with rasters of the wrong size
+type sizedRPC struct {
+	size int
+}
+
+func (w sizedRPC) Upload(in SceneUpload, out *bool) error {
+	*out = true
+	return nil
+}
+
+func (w sizedRPC) RenderCached(in CachedTileJob, out *CompressedRaster) error {
+	def := new(bytes.Buffer)
+	fw, _ := flate.NewWriter(def, flate.BestSpeed)
+	binary.Write(fw, binary.LittleEndian, make(Raster, w.size))
+	fw.Close()
+	out.Buf = def.Bytes()
+	return nil
+}
+
+func TestRPCRendererRasterSize(t *testing.T) {
+	scene := tinyScene()
+	tile := Tile{Pass: 1, Region: image.Rect(0, 0, 8, 4), Samples: 1}
+	bounds := scene.splatBounds(tile.Region)
+	want := bounds.Dx() * bounds.Dy()
+
+	for _, size := range []int{0, want - 1, want, want + 1} {
+		listen, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := rpc.NewServer()
+		server.RegisterName("RenderRPC", sizedRPC{size})
+		go server.Accept(listen)
+
+		renderer := NewRPCRenderer(listen.Addr().String()).(TileRenderer)
+		raster, err := renderer.RenderTile(context.Background(), scene, tile, nil)
+		switch {
+		case size == want && err != nil:
+			t.Errorf("raster of %d: %v", size, err)
+		case size == want && len(raster) != want:
+			t.Errorf("raster of %d, got %d pixels", size, len(raster))
+		case size != want && err == nil:
+			t.Errorf("raster of %d for a tile of %d pixels accepted", size, want)
+		}
+		listen.Close()
+	}
+}
@@ -3,6 +3,7 @@ package spt
 import (
 	"bytes"
 	"compress/flate"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"log"
@@ -12,10 +13,21 @@ import (
 	"time"
 )
 
-func RenderServeRPC(stop chan struct{}, port int) error {
-	if err := rpc.Register(RenderRPC{}); err != nil {
+func newRenderServer(cache *sceneCache) *rpc.Server {
+	server := rpc.NewServer()
+	if err := server.Register(RenderRPC{cache}); err != nil {
 		log.Fatal(err)
 	}
+	return server
+}
+
+func RenderServeRPC(stop chan struct{}, port int) error {
+	return RenderServeRPCWith(stop, port, Transport{})
+}
+
+// Serve RenderRPC with TLS, a token, or both.
+func RenderServeRPCWith(stop chan struct{}, port int, transport Transport) error {
+	server := newRenderServer(newSceneCache(sceneCacheSize))
 
 	listen, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 
@@ -29,42 +41,103 @@ func RenderServeRPC(stop chan struct{}, port int) error {
 	conns := make(chan net.Conn, 1)
 	var group sync.WaitGroup
 
+	// coordinators hold connections open across passes, so close them
+	// to stop
+	var open sync.Map
+
 	group.Add(1)
 	go func() {
-		for run {
+		defer group.Done()
+		for {
 			conn, err := listen.Accept()
 			if err != nil {
+				select {
+				case <-stop:
+					return
+				default:
+				}
 				log.Println("rpc-server", err)
 				continue
 			}
-			conns <- conn
+			select {
+			case conns <- conn:
+			case <-stop:
+				conn.Close()
+				return
+			}
 		}
-		group.Done()
 	}()
 
 	for run {
 		select {
 		case conn := <-conns:
 			group.Add(1)
+			open.Store(conn, true)
 			go func() {
-				rpc.ServeConn(conn)
-				group.Done()
+				defer group.Done()
+				defer open.Delete(conn)
+				secure, err := transport.accept(conn)
+				if err != nil {
+					log.Println("rpc-server", conn.RemoteAddr(), err)
+					return
+				}
+				server.ServeConn(secure)
 			}()
 		case <-stop:
 			log.Println("rpc-server stopping...")
 			run = false
-			if slave, err := rpc.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
-				slave.Close()
-			}
+			listen.Close()
 		}
 	}
 
+	open.Range(func(conn, _ interface{}) bool {
+		conn.(net.Conn).Close()
+		return true
+	})
+
 	group.Wait()
 	log.Println("rpc-server stopped")
 	return nil
 }
 
-type RenderRPC struct{}
+// Run a render worker until stop is closed: RenderRPC on port, render
+// jobs over HTTP at web when it's set, and a farm membership when join
+// is set. serve secures what the worker accepts, dial what it dials.
+func RenderWorker(stop chan struct{}, port int, web, join string, serve, dial Transport) error {
+	var group sync.WaitGroup
+	var err error
+
+	group.Add(1)
+	go func() {
+		err = RenderServeRPCWith(stop, port, serve)
+		group.Done()
+	}()
+
+	if web != "" {
+		group.Add(1)
+		go func() {
+			if err := RenderServeHTTPWith(stop, web, nil, serve); err != nil {
+				log.Println(err)
+			}
+			group.Done()
+		}()
+	}
+
+	if join != "" {
+		group.Add(1)
+		go func() {
+			JoinFarmWith(stop, join, port, dial)
+			group.Done()
+		}()
+	}
+
+	group.Wait()
+	return err
+}
+
+type RenderRPC struct {
+	cache *sceneCache
+}
 
 func (srv RenderRPC) Render(in Scene, out *CompressedRaster) error {
 	start := time.Now()
@@ -78,3 +151,66 @@ func (srv RenderRPC) Render(in Scene, out *CompressedRaster) error {
 	out.Buf = def.Bytes()
 	return nil
 }
+
+// A tile of a scene, sent to a worker to render.
+type TileJob struct {
+	Scene Scene
+	Tile  Tile
+}
+
+func (srv RenderRPC) RenderTile(in TileJob, out *CompressedRaster) error {
+	start := time.Now()
+	raster, err := in.Scene.RenderTile(context.Background(), in.Tile, nil)
+	if err != nil {
+		return err
+	}
+	log.Println("rpc-server tile", in.Tile.Pass, in.Tile.Region, time.Since(start))
+
+	def := new(bytes.Buffer)
+	fw, _ := flate.NewWriter(def, flate.BestCompression)
+	binary.Write(fw, binary.LittleEndian, raster)
+	fw.Close()
+	out.Buf = def.Bytes()
+	return nil
+}
+
+// A scene's Stuff, gob-encoded, uploaded once and then referred to by
+// its hash.
+type SceneUpload struct {
+	Hash  string
+	Stuff []byte
+}
+
+// The hash is checked, so no client can put one scene under another's.
+func (srv RenderRPC) Upload(in SceneUpload, out *bool) error {
+	start := time.Now()
+	hash := hashStuff(in.Stuff)
+	if in.Hash != hash {
+		return errSceneHash
+	}
+	stuff, err := decodeStuff(in.Stuff)
+	if err != nil {
+		return err
+	}
+	srv.cache.put(hash, stuff)
+	log.Println("rpc-server scene", hash[:12], len(in.Stuff), "bytes", time.Since(start))
+	*out = true
+	return nil
+}
+
+// A tile of a cached scene. The Scene carries everything but its Stuff.
+type CachedTileJob struct {
+	Hash  string
+	Scene Scene
+	Tile  Tile
+}
+
+func (srv RenderRPC) RenderCached(in CachedTileJob, out *CompressedRaster) error {
+	stuff, ok := srv.cache.get(in.Hash)
+	if !ok {
+		return errSceneUnknown
+	}
+	in.Scene.Stuff = stuff.stuff
+	in.Scene.tree = stuff.tree
+	return srv.RenderTile(TileJob{in.Scene, in.Tile}, out)
+}
@@ -0,0 +1,298 @@
+package spt
+
+import (
+	"encoding/gob"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sync"
+)
+
+func init() {
+	gob.Register(Stratified{})
+	gob.Register(Sobol{})
+	gob.Register(BlueNoise{})
+}
+
+// Where a sample's random numbers come from: its jitter within the pixel
+// first, then the aperture, then the choices at each bounce, one
+// dimension per call to Float64. Streams depend only on their arguments:
+// seed is Scene.Seed, and i numbers a pixel's samples across the whole
+// render, so each pass carries on where the last left off, however the
+// passes were shared out among workers.
+type Sampler interface {
+	// the stream for a pixel's sample i
+	Stream(seed int64, x, y, i int) Random
+}
+
+// Jittered samples stratified in each dimension: any power of two of a
+// pixel's samples, counting from the first, fall in that many different
+// strata of every dimension, in an order shuffled per dimension.
+type Stratified struct{}
+
+func (s Stratified) Stream(seed int64, x, y, i int) Random {
+	return &stratifiedStream{key: pixelKey(seed, x, y), i: uint32(i)}
+}
+
+type stratifiedStream struct {
+	key uint64
+	i   uint32
+	dim uint64
+}
+
+// A scrambled van der Corput sequence, with the samples shuffled apart
+// for each dimension.
+func (s *stratifiedStream) Float64() float64 {
+	h := mix64(s.key ^ mix64(s.dim))
+	s.dim++
+	index := owenScramble(s.i, uint32(h))
+	return float64(owenScramble(sobol(index, 0), uint32(h>>32))) / (1 << 32)
+}
+
+// Owen-scrambled Sobol points, scrambled apart for each pixel. Dimensions
+// come in padded sets of four, each set with its own shuffle of the
+// points, after Burley's "Practical Hash-based Owen Scrambling".
+type Sobol struct{}
+
+func (s Sobol) Stream(seed int64, x, y, i int) Random {
+	return &sobolStream{key: pixelKey(seed, x, y), i: uint32(i)}
+}
+
+type sobolStream struct {
+	key uint64
+	i   uint32
+	dim uint64
+}
+
+func (s *sobolStream) Float64() float64 {
+	pad := mix64(s.key ^ mix64(s.dim/4+1))
+	index := owenScramble(s.i, uint32(pad))
+	v := owenScramble(sobol(index, int(s.dim%4)), uint32(mix64(pad^s.dim)))
+	s.dim++
+	return float64(v) / (1 << 32)
+}
+
+// Sobol points shared by every pixel, each pixel and dimension shifted
+// by a blue noise mask, so that the error left in an image is spread
+// finely over neighbouring pixels, where it's least visible and the
+// denoiser removes it most easily. Helps even at one sample per pass.
+type BlueNoise struct{}
+
+func (s BlueNoise) Stream(seed int64, x, y, i int) Random {
+	return &blueNoiseStream{sobolStream{key: pixelKey(seed, 0, 0), i: uint32(i)}, x, y}
+}
+
+type blueNoiseStream struct {
+	sobolStream
+	x, y int
+}
+
+func (s *blueNoiseStream) Float64() float64 {
+	// a different toroidal shift of the mask for each dimension
+	shift := mix64(s.dim)
+	v := s.sobolStream.Float64()
+	x := (s.x + int(shift&0xffff)) % blueNoiseSize
+	y := (s.y + int(shift>>16&0xffff)) % blueNoiseSize
+	v += blueNoiseMask()[y*blueNoiseSize+x]
+	if v >= 1 {
+		v--
+	}
+	return v
+}
+
+// Passes' seeds for independent random numbers are this far apart.
+const passStride = 1000003
+
+// Independent random numbers for a row of a pass, when there's no
+// Sampler. Each pixel has a stream of its own, keyed by the seed, the
+// pass, the row and its column, so a render with a given seed is the
+// same however its rows and tiles were shared out among workers.
+type rowStream uint64
+
+func newRowStream(passSeed int64, y int) rowStream {
+	return rowStream(mix64(uint64(passSeed) ^ mix64(uint64(uint32(y))+1)))
+}
+
+func (r rowStream) pixel(x int) *splitMix {
+	return &splitMix{mix64(uint64(r) ^ mix64(uint64(uint32(x))+1))}
+}
+
+// SplitMix64, cheap enough to start one per pixel
+type splitMix struct {
+	state uint64
+}
+
+func (s *splitMix) Float64() float64 {
+	s.state += 0x9e3779b97f4a7c15
+	return unit64(mix64(s.state))
+}
+
+// SplitMix64's finalizer
+func mix64(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+func pixelKey(seed int64, x, y int) uint64 {
+	return mix64(uint64(seed) ^ mix64(uint64(uint32(x))<<32|uint64(uint32(y))))
+}
+
+// 0..1 from the top 53 bits
+func unit64(h uint64) float64 {
+	return float64(h>>11) / (1 << 53)
+}
+
+// A hash-based nested uniform scramble: each bit flipped depending only
+// on the bits above it, as Owen scrambling does.
+func owenScramble(v, seed uint32) uint32 {
+	v = bits.Reverse32(v)
+	v += seed
+	v ^= v * 0x6c50b47c
+	v ^= v * 0xb82f1e52
+	v ^= v * 0xc7afe638
+	v ^= v * 0x8d22f6e6
+	return bits.Reverse32(v)
+}
+
+// direction numbers for the first four Sobol dimensions, from Joe and
+// Kuo's primitive polynomials
+var sobolDirections = func() [4][32]uint32 {
+	var d [4][32]uint32
+	polys := []struct {
+		s, a uint
+		m    []uint32
+	}{
+		{1, 0, []uint32{1}},
+		{2, 1, []uint32{1, 3}},
+		{3, 1, []uint32{1, 3, 1}},
+	}
+	for k := uint(0); k < 32; k++ {
+		d[0][k] = 1 << (31 - k)
+	}
+	for j, p := range polys {
+		v := &d[j+1]
+		for k := uint(0); k < 32; k++ {
+			if k < p.s {
+				v[k] = p.m[k] << (31 - k)
+				continue
+			}
+			v[k] = v[k-p.s] ^ v[k-p.s]>>p.s
+			for l := uint(1); l < p.s; l++ {
+				if p.a>>(p.s-1-l)&1 == 1 {
+					v[k] ^= v[k-l]
+				}
+			}
+		}
+	}
+	return d
+}()
+
+func sobol(i uint32, dim int) uint32 {
+	var v uint32
+	for k := 0; i != 0; i, k = i>>1, k+1 {
+		if i&1 == 1 {
+			v ^= sobolDirections[dim][k]
+		}
+	}
+	return v
+}
+
+const blueNoiseSize = 64
+
+var (
+	blueNoiseOnce sync.Once
+	blueNoise     []float64
+)
+
+// A tileable blue noise mask of ranks in 0..1, made once by Ulichney's
+// void-and-cluster method.
+func blueNoiseMask() []float64 {
+	blueNoiseOnce.Do(func() {
+		blueNoise = voidAndCluster(blueNoiseSize, 1.5)
+	})
+	return blueNoise
+}
+
+func voidAndCluster(size int, sigma float64) []float64 {
+	n := size * size
+	// the energy each set pixel adds around it, wrapping at the edges
+	kernel := make([]float64, n)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x), float64(y)
+			dx, dy = min(dx, float64(size)-dx), min(dy, float64(size)-dy)
+			kernel[y*size+x] = math.Exp(-(dx*dx + dy*dy) / (2 * sigma * sigma))
+		}
+	}
+	set := make([]bool, n)
+	energy := make([]float64, n)
+	toggle := func(i int, on bool) {
+		set[i] = on
+		sign := 1.0
+		if !on {
+			sign = -1
+		}
+		px, py := i%size, i/size
+		for y := 0; y < size; y++ {
+			row := (y - py + size) % size * size
+			for x := 0; x < size; x++ {
+				energy[y*size+x] += sign * kernel[row+(x-px+size)%size]
+			}
+		}
+	}
+	// the set pixel with the most energy, or the empty one with the least
+	extreme := func(on bool) int {
+		best := -1
+		for i := range energy {
+			if set[i] == on && (best < 0 || (on && energy[i] > energy[best]) || (!on && energy[i] < energy[best])) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// a random tenth, spread out by moving the tightest cluster to the
+	// largest void until that undoes itself
+	rnd := rand.New(rand.NewSource(1))
+	initial := n / 10
+	for _, i := range rnd.Perm(n)[:initial] {
+		toggle(i, true)
+	}
+	for {
+		cluster := extreme(true)
+		toggle(cluster, false)
+		void := extreme(false)
+		toggle(void, true)
+		if void == cluster {
+			break
+		}
+	}
+
+	// rank the initial pixels by removing the tightest clusters, then the
+	// rest by filling the largest voids
+	rank := make([]int, n)
+	pattern := append([]bool(nil), set...)
+	saved := append([]float64(nil), energy...)
+	for r := initial - 1; r >= 0; r-- {
+		i := extreme(true)
+		rank[i] = r
+		toggle(i, false)
+	}
+	copy(set, pattern)
+	copy(energy, saved)
+	for r := initial; r < n; r++ {
+		i := extreme(false)
+		rank[i] = r
+		toggle(i, true)
+	}
+
+	mask := make([]float64, n)
+	for i, r := range rank {
+		mask[i] = (float64(r) + 0.5) / float64(n)
+	}
+	return mask
+}
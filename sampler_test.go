@@ -0,0 +1,146 @@
+package spt
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+var testSamplers = []Sampler{Stratified{}, Sobol{}, BlueNoise{}}
+
+func TestSamplers(t *testing.T) {
+	const n = 16
+	for _, sampler := range testSamplers {
+		// the same for the same seed, and not for another
+		a, b, c := sampler.Stream(7, 3, 5, 2), sampler.Stream(7, 3, 5, 2), sampler.Stream(8, 3, 5, 2)
+		for dim := 0; dim < 20; dim++ {
+			va, vb, vc := a.Float64(), b.Float64(), c.Float64()
+			if va != vb {
+				t.Fatalf("%T: dimension %d %v then %v", sampler, dim, va, vb)
+			}
+			if va == vc {
+				t.Errorf("%T: dimension %d the same for another seed", sampler, dim)
+			}
+		}
+	}
+
+	// every dimension of a pixel's first n samples in distinct strata, and
+	// of the next n, as later passes take them
+	for _, sampler := range []Sampler{Stratified{}, Sobol{}} {
+		for dim := 0; dim < 18; dim++ {
+			seen := map[int]bool{}
+			for i := dim / 9 * n; i < (dim/9+1)*n; i++ {
+				stream := sampler.Stream(7, 3, 5, i)
+				var v float64
+				for d := 0; d <= dim%9; d++ {
+					v = stream.Float64()
+				}
+				if v < 0 || v >= 1 {
+					t.Fatalf("%T: dimension %d sample %d is %v", sampler, dim, i, v)
+				}
+				seen[int(v*n)] = true
+			}
+			if len(seen) != n {
+				t.Errorf("%T: dimension %d fills %d of %d strata", sampler, dim, len(seen), n)
+			}
+		}
+	}
+
+	// blue noise gives every pixel the same points, shifted
+	for dim := 0; dim < 9; dim++ {
+		var shift float64
+		for i := 0; i < n; i++ {
+			a, b := BlueNoise{}.Stream(7, 3, 5, i), BlueNoise{}.Stream(7, 4, 5, i)
+			var va, vb float64
+			for d := 0; d <= dim; d++ {
+				va, vb = a.Float64(), b.Float64()
+			}
+			d := math.Mod(vb-va+1, 1)
+			if i == 0 {
+				shift = d
+			} else if math.Abs(d-shift) > 1e-9 && math.Abs(d-shift) < 1-1e-9 {
+				t.Fatalf("dimension %d sample %d shifted by %v, not %v", dim, i, d, shift)
+			}
+		}
+	}
+
+	// Sobol pairs fill every cell of a grid too
+	for _, pair := range [][2]int{{0, 1}, {2, 3}, {4, 5}} {
+		seen := map[[2]int]bool{}
+		for i := 0; i < 16; i++ {
+			stream := Sobol{}.Stream(1, 0, 0, i)
+			var v [6]float64
+			for d := range v {
+				v[d] = stream.Float64()
+			}
+			seen[[2]int{int(v[pair[0]] * 4), int(v[pair[1]] * 4)}] = true
+		}
+		if len(seen) != 16 {
+			t.Errorf("dimensions %v fill %d of 16 cells", pair, len(seen))
+		}
+	}
+}
+
+func TestBlueNoise(t *testing.T) {
+	mask := blueNoiseMask()
+	seen := map[float64]bool{}
+	for _, v := range mask {
+		seen[v] = true
+	}
+	if len(seen) != len(mask) {
+		t.Errorf("%d distinct ranks of %d", len(seen), len(mask))
+	}
+	// neighbours differ by more than the third expected of white noise
+	diff := 0.0
+	for y := 0; y < blueNoiseSize; y++ {
+		for x := 0; x < blueNoiseSize; x++ {
+			v := mask[y*blueNoiseSize+x]
+			diff += math.Abs(v - mask[y*blueNoiseSize+(x+1)%blueNoiseSize])
+			diff += math.Abs(v - mask[(y+1)%blueNoiseSize*blueNoiseSize+x])
+		}
+	}
+	if diff /= float64(2 * len(mask)); diff < 0.38 {
+		t.Errorf("mean neighbour difference %.3f", diff)
+	}
+}
+
+func samplerError(sampler Sampler, seed int64, passes, samples int, reference *Scene) float64 {
+	scene := tinyScene()
+	scene.Passes, scene.Samples = passes, samples
+	scene.Seed = seed
+	scene.Sampler = sampler
+	var last *Scene
+	for frame := range RenderContext(context.Background(), scene, nil, RenderOptions{Deadline: time.Now().Add(time.Minute)}) {
+		last = frame.(*Scene)
+	}
+	return displayError(last, reference)
+}
+
+// 16 samples closer to many more than independent ones get, whether in
+// one pass or spread one at a time over many
+func TestSamplerConvergence(t *testing.T) {
+	scene := tinyScene()
+	scene.Passes, scene.Samples = 4, 256
+	scene.Seed = 1
+	var reference *Scene
+	for frame := range RenderContext(context.Background(), scene, nil, RenderOptions{Deadline: time.Now().Add(time.Minute)}) {
+		reference = frame.(*Scene)
+	}
+	mse := func(sampler Sampler, passes, samples int) float64 {
+		const seeds = 16
+		e := 0.0
+		for seed := int64(1); seed <= seeds; seed++ {
+			e += samplerError(sampler, seed, passes, samples, reference)
+		}
+		return e / seeds
+	}
+	for _, split := range [][2]int{{1, 16}, {16, 1}} {
+		independent := mse(nil, split[0], split[1])
+		for _, sampler := range testSamplers {
+			if e := mse(sampler, split[0], split[1]); e >= independent {
+				t.Errorf("%T, %d passes of %d: error %.6f, independent samples %.6f", sampler, split[0], split[1], e, independent)
+			}
+		}
+	}
+}
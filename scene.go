@@ -2,13 +2,14 @@ package spt
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"image"
 	"image/color"
 	"image/png"
 	"io/ioutil"
 	"math"
-	"math/rand"
+	"reflect"
 	"runtime"
 	"time"
 )
@@ -18,31 +19,54 @@ func init() {
 }
 
 type Scene struct {
-	Seed      int64   // Optional
-	Camera    Camera  // Required
-	Stuff     []Thing // Required
-	Width     int     // in pixels
-	Height    int     // in pixels
-	Passes    int     // number of render passes
-	Samples   int     // number of jittered samples per pixel
-	Bounces   int     // max shadow ray bounces
-	Horizon   float64 // max scene distance from 0,0,0 to limit marching rays
-	Threshold float64 // distance from SDF considered close enough to be a hit
-	Ambient   Color   // color when rays stop before reaching a light
-	ShadowH   float64 // shadow alpha upper limit on invisible surfaces (dark center)
-	ShadowL   float64 // shadow alpha lower limit on invisible surfaces (prenumbra cut-off)
-	ShadowD   float64 // shadow darkness (light brightness multipler)
-	ShadowR   float64 // shadow sharpness (light radius multipler)
-	Raster    Raster  // summed samples per pixel
+	Seed      int64    // Optional, renders with the same seed match however they're shared out
+	Camera    Camera   // Required
+	Stuff     []Thing  // Required
+	Width     int      // in pixels
+	Height    int      // in pixels
+	Passes    int      // number of render passes
+	Samples   int      // number of jittered samples per pixel per pass, at most MaxSamples
+	Bounces   int      // max shadow ray bounces
+	Horizon   float64  // max scene distance from 0,0,0 to limit marching rays
+	Threshold float64  // distance from SDF considered close enough to be a hit
+	Ambient   Color    // color when rays stop before reaching a light
+	ShadowH   float64  // shadow alpha upper limit on invisible surfaces (dark center)
+	ShadowL   float64  // shadow alpha lower limit on invisible surfaces (prenumbra cut-off)
+	ShadowD   float64  // shadow darkness (light brightness multipler)
+	ShadowR   float64  // shadow sharpness (light radius multipler)
+	Adaptive  bool     // spread each pass's samples by per-pixel noise
+	AOV       bool     // record depth, normal, albedo and IDs of primary hits in Raster
+	Noise     float64  // stop once every pixel's noise is below this, implies Adaptive
+	Display   Display  // exposure and tone mapping for At, and so PNGs
+	Filter    Filter   // Optional, spreads samples over nearby pixels, nil keeps them in their own
+	Sampler   Sampler  // Optional, low-discrepancy sample numbers, independent random ones when nil
+	Budget    []uint16 // per-pixel samples for this pass, overriding Samples
+	Pass      int      // the pass Render renders, its samples following the earlier passes'
+	Taken     []uint32 // per-pixel samples in earlier passes, for adaptive renders, overriding Pass for Sampler
+	Raster    Raster   // summed samples per pixel
+	tree      *thingTree
 }
 
+// most samples a pixel can take in a pass, as Budget holds them
+const MaxSamples = math.MaxUint16
+
 var _ image.Image = (*Scene)(nil)
 var Transparent = color.Transparent
 
 type Pixel struct {
-	Color Color
-	Rays  int32   // encoding/gob won't send a slice of pixels using a platform-dependent int size
-	Alpha float64 // candidate for invisible shadows-only surface
+	Color  Color
+	Rays   int32   // encoding/gob won't send a slice of pixels using a platform-dependent int size
+	Weight float64 // summed filter weights of the samples in Color and Alpha
+	Alpha  float64 // candidate for invisible shadows-only surface
+	Sum    float64 // summed brightness of the pixel's own samples, unfiltered, for variance
+	Square float64 // summed squared sample brightness, for variance
+	// the AOVs, when Scene.AOV is set, summed like Color
+	Depth    float64 // distance from the camera to primary hits
+	Normal   Vec3    // world normal at primary hits
+	Albedo   Color   // base color of the material at primary hits
+	Hits     int32   // primary rays that hit something
+	Object   int32   // 1 + index in Scene.Stuff of the first primary hit, or 0
+	Material int32   // 1 + index of its material among the scene's distinct ones, or 0
 }
 
 type Raster []Pixel
@@ -60,52 +84,231 @@ func (scene *Scene) Merge(raster Raster) {
 		for x := 0; x < scene.Width; x++ {
 			spixel := &scene.Raster[y*scene.Width+x]
 			rpixel := &raster[y*scene.Width+x]
-			spixel.Color = spixel.Color.Add(rpixel.Color)
-			spixel.Rays += rpixel.Rays
-			spixel.Alpha += rpixel.Alpha
+			spixel.merge(rpixel)
+		}
+	}
+}
+
+func (p *Pixel) merge(q *Pixel) {
+	p.Color = p.Color.Add(q.Color)
+	p.Rays += q.Rays
+	p.Weight += q.Weight
+	p.Alpha += q.Alpha
+	p.Sum += q.Sum
+	p.Square += q.Square
+	p.Depth += q.Depth
+	p.Normal = p.Normal.Add(q.Normal)
+	p.Albedo = p.Albedo.Add(q.Albedo)
+	p.Hits += q.Hits
+	if p.Object == 0 {
+		p.Object, p.Material = q.Object, q.Material
+	}
+}
+
+// Add a tile's raster into the scene's raster. It covers the tile's
+// region and as far around it as the filter spread its samples.
+func (scene *Scene) MergeTile(region image.Rectangle, raster Raster) {
+	bounds := scene.splatBounds(region)
+	width := bounds.Dx()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			spixel := &scene.Raster[y*scene.Width+x]
+			rpixel := &raster[(y-bounds.Min.Y)*width+(x-bounds.Min.X)]
+			spixel.merge(rpixel)
 		}
 	}
 }
 
 func (scene Scene) Render() Raster {
+	raster, _ := scene.RenderContext(context.Background(), nil)
+	return raster
+}
+
+// Render a single pass, giving up early once ctx is done. When row is set
+// it is called, possibly concurrently, with the rays traced for each row
+// as it finishes.
+func (scene Scene) RenderContext(ctx context.Context, row func(rays int)) (Raster, error) {
+	return scene.RenderTile(ctx, Tile{
+		Pass:    scene.Pass,
+		Region:  scene.Bounds(),
+		Samples: scene.Samples,
+		Budget:  scene.Budget,
+		Taken:   scene.Taken,
+	}, row)
+}
+
+// Render one tile, returning a raster covering its region and, with a
+// filter, the pixels around it that its samples spread to.
+func (scene Scene) RenderTile(ctx context.Context, tile Tile, row func(rays int)) (Raster, error) {
 
 	if scene.Seed == 0 {
 		scene.Seed = time.Now().UTC().UnixNano()
 	}
 
-	grnd := rand.New(rand.NewSource(scene.Seed))
+	// passes mustn't repeat each other's samples, but tiles and workers
+	// must agree on them
+	region := tile.Region
+	passSeed := scene.Seed + int64(tile.Pass)*passStride
 
-	for i := range scene.Stuff {
-		t := &scene.Stuff[i]
-		t.Prepare()
+	// local renderers share Stuff, so prepare a copy unless the caller
+	// already has
+	if scene.tree == nil {
+		scene.Stuff = append([]Thing(nil), scene.Stuff...)
+		scene.prepare()
 	}
 
-	raster := make(Raster, scene.Width*scene.Height)
+	width := region.Dx()
+	bounds := scene.splatBounds(region)
+	pad := filterPad(scene.Filter)
+	raster := make(Raster, bounds.Dx()*bounds.Dy())
 	semaphore := make(chan struct{}, runtime.NumCPU())
+	done := ctx.Done()
 
-	for y := 0; y < scene.Height; y++ {
+	// Rows spread samples into each other's pixels, so they gather their
+	// filtered colors apart and add them in turn, in order, so that the
+	// sums don't depend on which row finished first.
+	turns := make([]chan struct{}, region.Dy()+1)
+	for i := range turns {
+		turns[i] = make(chan struct{})
+	}
+	close(turns[0])
+
+	cancelled := func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}
+
+	started := 0
+	for y := region.Min.Y; y < region.Max.Y && !cancelled(); y++ {
 		semaphore <- struct{}{}
+		started++
 		go func(y int) {
-			rnd := rand.New(rand.NewSource(grnd.Int63()))
-			for x := 0; x < scene.Width; x++ {
-				for sample := 0; sample < scene.Samples; sample++ {
-					u := rnd.Float64()
-					v := rnd.Float64()
-					r := scene.Camera.CastRay(x, y, scene.Width, scene.Height, u, v, rnd)
-					c, _, p := r.PathTrace(&scene, 0, nil)
-					pixel := &raster[y*scene.Width+x]
-					pixel.Color = pixel.Color.Add(c)
-					pixel.Alpha += p
+			turn := y - region.Min.Y
+			defer close(turns[turn+1])
+			stream := newRowStream(passSeed, y)
+			rays := 0
+			var filtered []splat // rows y-pad to y+pad of bounds
+			if scene.Filter != nil {
+				filtered = make([]splat, (2*pad+1)*bounds.Dx())
+			}
+			for x := region.Min.X; x < region.Max.X && !cancelled(); x++ {
+				i := (y-region.Min.Y)*width + (x - region.Min.X)
+				samples := tile.Samples
+				if tile.Budget != nil {
+					samples = int(tile.Budget[i])
+				}
+				// samplers carry on from the pixel's earlier passes
+				taken := 0
+				if tile.Taken != nil {
+					taken = int(tile.Taken[i])
+				} else if tile.Pass > 1 {
+					taken = (tile.Pass - 1) * tile.Samples
+				}
+				pixel := &raster[(y-bounds.Min.Y)*bounds.Dx()+(x-bounds.Min.X)]
+				rnd := stream.pixel(x)
+				for sample := 0; sample < samples; sample++ {
+					var numbers Random = rnd
+					if scene.Sampler != nil {
+						numbers = scene.Sampler.Stream(scene.Seed, x, y, taken+sample)
+					}
+					u := numbers.Float64()
+					v := numbers.Float64()
+					r := scene.Camera.CastRay(x, y, scene.Width, scene.Height, u, v, numbers)
+					var aov *Pixel
+					if scene.AOV {
+						aov = pixel
+					}
+					c, _, p := r.pathTrace(&scene, 0, nil, aov)
+					b := c.Brightness()
+					pixel.Sum += b
+					pixel.Square += b * b
 					pixel.Rays++
+					rays++
+					if scene.Filter == nil {
+						pixel.Color = pixel.Color.Add(c)
+						pixel.Alpha += p
+						pixel.Weight++
+						continue
+					}
+					// pixel centers are at +0.5
+					for py := y - pad; py <= y+pad; py++ {
+						for px := x - pad; px <= x+pad; px++ {
+							if !(image.Point{px, py}).In(bounds) {
+								continue
+							}
+							w := scene.Filter.Weight(float64(x-px)+u-0.5, float64(y-py)+v-0.5)
+							if w == 0 {
+								continue
+							}
+							f := &filtered[(py-y+pad)*bounds.Dx()+(px-bounds.Min.X)]
+							f.Color = f.Color.Add(c.Scale(w))
+							f.Alpha += p * w
+							f.Weight += w
+						}
+					}
 				}
 			}
+			if row != nil && !cancelled() {
+				row(rays)
+			}
 			<-semaphore
+
+			<-turns[turn]
+			for py := y - pad; py <= y+pad && filtered != nil; py++ {
+				if py < bounds.Min.Y || py >= bounds.Max.Y {
+					continue
+				}
+				for px := bounds.Min.X; px < bounds.Max.X; px++ {
+					f := &filtered[(py-y+pad)*bounds.Dx()+(px-bounds.Min.X)]
+					p := &raster[(py-bounds.Min.Y)*bounds.Dx()+(px-bounds.Min.X)]
+					p.Color = p.Color.Add(f.Color)
+					p.Alpha += f.Alpha
+					p.Weight += f.Weight
+				}
+			}
 		}(y)
 	}
-	for i := 0; i < runtime.NumCPU(); i++ {
-		semaphore <- struct{}{}
+	<-turns[started]
+	return raster, ctx.Err()
+}
+
+func (scene *Scene) prepare() {
+	// materials equal by value share an ID
+	materials := map[Material]int32{}
+	next := int32(0)
+	for i := range scene.Stuff {
+		t := &scene.Stuff[i]
+		t.Prepare()
+		t.index = int32(i)
+		if t.Mat == nil || !reflect.TypeOf(t.Mat).Comparable() {
+			t.material, next = next, next+1
+			continue
+		}
+		id, ok := materials[t.Mat]
+		if !ok {
+			id, next = next, next+1
+			materials[t.Mat] = id
+		}
+		t.material = id
 	}
-	return raster
+	scene.tree = newThingTree(scene.Stuff)
+}
+
+func (scene *Scene) lights() []*Thing {
+	if scene.tree != nil {
+		return scene.tree.lights
+	}
+	var lights []*Thing
+	for i := range scene.Stuff {
+		if _, is := scene.Stuff[i].Material().Light(); is {
+			lights = append(lights, &scene.Stuff[i])
+		}
+	}
+	return lights
 }
 
 func (scene *Scene) ColorModel() color.Model {
@@ -115,30 +318,39 @@ func (scene *Scene) ColorModel() color.Model {
 
 func (scene *Scene) At(x, y int) color.Color {
 
+	c, alpha := scene.Linear(x, y)
+	if c == Naught {
+		return Transparent
+	}
+	return displayColor(scene.Display.Apply(c), alpha)
+}
+
+// The average linear radiance at x, y, unclamped, and its alpha: 1 unless
+// the pixel is empty or caught only shadows. Alpha is not premultiplied.
+func (scene *Scene) Linear(x, y int) (Color, float64) {
+
 	pixel := &scene.Raster[y*scene.Width+x]
+	if pixel.Rays == 0 {
+		return Naught, 0
+	}
 	// average
-	c := pixel.Color.Scale(1.0 / float64(pixel.Rays))
-	// gamma correction
-	c = Color{R: math.Sqrt(c.R), G: math.Sqrt(c.G), B: math.Sqrt(c.B)}
+	c := pixel.mean()
 
 	if c == Naught {
-		return Transparent
+		return c, 0
 	}
 
-	alpha := float64(pixel.Alpha) / float64(pixel.Rays)
+	alpha := math.Max(0, pixel.Alpha/pixel.weight())
 
 	if alpha < scene.ShadowL {
 		alpha = 0.0
 	}
 
 	if alpha < scene.ShadowH+0.01 {
-		u := func(v float64) uint8 {
-			return uint8(255.0 * v)
-		}
-		return color.NRGBA{u(c.R), u(c.G), u(c.B), u(alpha)}
+		return c, math.Min(alpha, 1)
 	}
 
-	return c
+	return c, 1
 }
 
 func (scene *Scene) Bounds() image.Rectangle {
@@ -0,0 +1,994 @@
+package spt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scene files are YAML or JSON. Shapes and materials are mappings with a
+// single key naming their type, the Go name less any SDF prefix, holding
+// their fields by lowerCamel name:
+//
+//	version: 1
+//	width: 640
+//	height: 360
+//	passes: 10
+//	samples: 4
+//	...
+//	camera: {lookFrom: [0, -3000, 1500], lookAt: [0, 0, 0], up: [0, 0, 1], fov: 40, focus: [0, 0, 0], aperture: 0}
+//	stuff:
+//	  - material: {metallic: {color: [0.4, 0.4, 0.4], roughness: 0.95}}
+//	    sdf:
+//	      translate:
+//	        offset: [0, 0, 500]
+//	        sdf: {sphere: {r: 500}}
+//
+// Vectors and colors are lists of numbers, and an SDF embedded in another
+// is its sdf field. Transforms are saved as translate or transform with a
+// 4x4 matrix; rotate, with an axis and degrees, may be used when writing
+// scenes by hand, and so may a metal's name (steel, gold...) for a
+// material. A tone map, filter or sampler without settings may be just
+// its name:
+//
+//	display: {exposure: -1, tone: aces}
+//	filter: mitchell
+//	sampler: sobol
+const sceneVersion = 1
+
+// Formats for WriteScene.
+const (
+	SceneYAML = "yaml"
+	SceneJSON = "json"
+)
+
+// A problem with a scene file, and where it is.
+type SceneError struct {
+	File   string // set by LoadScene
+	Line   int
+	Column int
+	Path   string // such as stuff[2].sdf.union.items[0].sphere.r
+	Msg    string
+}
+
+func (e *SceneError) Error() string {
+	where := fmt.Sprintf("%d:%d", e.Line, e.Column)
+	if e.File != "" {
+		where = e.File + ":" + where
+	}
+	if e.Path != "" {
+		return fmt.Sprintf("%s: %s: %s", where, e.Path, e.Msg)
+	}
+	return where + ": " + e.Msg
+}
+
+func sceneFail(n *yaml.Node, path, format string, args ...interface{}) error {
+	return &SceneError{Line: n.Line, Column: n.Column, Path: path, Msg: fmt.Sprintf(format, args...)}
+}
+
+// shorthand types, which scenes use in place of an SDFTransform
+type sceneShorthand interface {
+	expand() SDF3
+}
+
+type sceneTranslate struct {
+	Offset Vec3
+	SDF3
+}
+
+func (s sceneTranslate) expand() SDF3 {
+	return Translate(s.Offset, s.SDF3)
+}
+
+type sceneRotate struct {
+	Axis    Vec3
+	Degrees float64
+	SDF3
+}
+
+func (s sceneRotate) expand() SDF3 {
+	return Rotate(s.Axis, s.Degrees, s.SDF3)
+}
+
+type sceneTransform struct {
+	M Matrix44
+	SDF3
+}
+
+func (s sceneTransform) expand() SDF3 {
+	return SDFTransform{s.SDF3, s.M, s.M.Inverse()}
+}
+
+// the camera as NewCamera takes it
+type sceneCamera struct {
+	LookFrom Vec3
+	LookAt   Vec3
+	Up       Vec3
+	Fov      float64
+	Focus    Vec3
+	Aperture float64
+}
+
+var (
+	sceneTypes = map[string]reflect.Type{}
+	sceneNames = map[reflect.Type]string{}
+
+	sdf2Type      = reflect.TypeOf((*SDF2)(nil)).Elem()
+	sdf3Type      = reflect.TypeOf((*SDF3)(nil)).Elem()
+	materialType  = reflect.TypeOf((*Material)(nil)).Elem()
+	toneType      = reflect.TypeOf((*ToneMap)(nil)).Elem()
+	filterType    = reflect.TypeOf((*Filter)(nil)).Elem()
+	samplerType   = reflect.TypeOf((*Sampler)(nil)).Elem()
+	shorthandType = reflect.TypeOf((*sceneShorthand)(nil)).Elem()
+	thingType     = reflect.TypeOf(Thing{})
+
+	sceneMetals = map[string]Material{
+		"steel":     Steel,
+		"stainless": Stainless,
+		"gold":      Gold,
+		"copper":    Copper,
+		"brass":     Brass,
+	}
+)
+
+// New SDFs, materials, tone maps, filters and samplers need adding here,
+// as well as to gob.
+func init() {
+	for _, v := range []interface{}{
+		Nothing{}, Diffuse{}, Emitter{}, Metallic{}, Dielectric{}, Invisible{},
+
+		SDFCircle{}, SDFRectangle{}, SDFTriangle{}, SDFPolygon{}, SDFStadium{},
+		SDFParabola{}, SDFHexagram{},
+
+		SDFExtrude{}, SDFRevolve{}, SDFSphere{}, SDFCube{}, SDFTorus{}, SDFCone{},
+		SDFRounded{}, SDFHollow{}, SDFElongate{}, SDFRepeat{}, SDFEllipsoid{},
+		SDFMesh{}, SDFBaked{},
+
+		SDFScale{}, SDFDistort{}, SDFMirror{},
+		SDFUnion{}, SDFDifference{}, SDFIntersection{},
+		SDFSmoothUnion{}, SDFSmoothDifference{}, SDFSmoothIntersection{},
+		SDFChamferUnion{}, SDFChamferDifference{}, SDFChamferIntersection{},
+		SDFStairsUnion{}, SDFStairsDifference{}, SDFStairsIntersection{},
+		SDFColumnsUnion{}, SDFColumnsDifference{}, SDFColumnsIntersection{},
+
+		Clip{}, Reinhard{}, ACES{}, Hable{},
+		Box{}, Tent{}, Gaussian{}, Mitchell{}, Lanczos{},
+		Stratified{}, Sobol{}, BlueNoise{},
+
+		sceneTranslate{}, sceneRotate{}, sceneTransform{},
+	} {
+		t := reflect.TypeOf(v)
+		name := strings.TrimPrefix(strings.TrimPrefix(t.Name(), "SDF"), "scene")
+		name = lowerFirst(name)
+		sceneTypes[name] = t
+		sceneNames[t] = name
+	}
+}
+
+// lowerCamel, with an all-capitals name such as ACES lowered whole
+func lowerFirst(s string) string {
+	if strings.ToUpper(s) == s {
+		return strings.ToLower(s)
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
+
+// tone maps, filters and samplers may be left out, unlike shapes and
+// materials
+func isOptional(t reflect.Type) bool {
+	return t == toneType || t == filterType || t == samplerType
+}
+
+// structs of only floats, other than shapes, are written as lists
+func isVector(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t.NumField() == 0 {
+		return false
+	}
+	if _, ok := sceneNames[t]; ok {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath != "" || f.Type.Kind() != reflect.Float64 {
+			return false
+		}
+	}
+	return true
+}
+
+type sceneField struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+// A struct's fields by scene name. Embedded SDFs are sdf, embedded
+// vectors are named for their type, and other embedded structs are
+// flattened.
+func sceneFields(t reflect.Type) []sceneField {
+	var fields []sceneField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		switch {
+		case f.Anonymous && f.Type.Kind() == reflect.Interface:
+			fields = append(fields, sceneField{"sdf", []int{i}, f.Type})
+		case f.Anonymous && f.Type.Kind() == reflect.Struct && !isVector(f.Type):
+			for _, sub := range sceneFields(f.Type) {
+				sub.index = append([]int{i}, sub.index...)
+				fields = append(fields, sub)
+			}
+		default:
+			fields = append(fields, sceneField{lowerFirst(f.Name), []int{i}, f.Type})
+		}
+	}
+	return fields
+}
+
+// the scene settings, which are everything but the parts handled apart
+func sceneSettings() []sceneField {
+	var settings []sceneField
+	for _, f := range sceneFields(reflect.TypeOf(Scene{})) {
+		switch f.name {
+		case "camera", "stuff", "budget", "pass", "taken", "raster":
+		default:
+			settings = append(settings, f)
+		}
+	}
+	return settings
+}
+
+// Levenshtein distance, for suggestions
+func editDistance(a, b string) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			next := row[j] + 1
+			if row[j-1]+1 < next {
+				next = row[j-1] + 1
+			}
+			if prev+cost < next {
+				next = prev + cost
+			}
+			prev, row[j] = row[j], next
+		}
+	}
+	return row[len(b)]
+}
+
+// "; did you mean x?" for the closest of names, if any is close
+func suggest(name string, names []string) string {
+	best, dist := "", 3
+	for _, n := range names {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(n)); d < dist {
+			best, dist = n, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf("; did you mean %s?", best)
+}
+
+func child(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Read a scene in YAML or JSON.
+func ReadScene(r io.Reader) (Scene, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Scene{}, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Scene{}, err
+	}
+	if len(doc.Content) == 0 {
+		return Scene{}, errors.New("empty scene")
+	}
+	return decodeSceneNode(doc.Content[0])
+}
+
+func LoadScene(path string) (Scene, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Scene{}, err
+	}
+	scene, err := ReadScene(bytes.NewReader(data))
+	if e, ok := err.(*SceneError); ok {
+		e.File = path
+	} else if err != nil {
+		err = fmt.Errorf("%s: %v", path, err)
+	}
+	return scene, err
+}
+
+// Write a scene as SceneYAML or SceneJSON.
+func WriteScene(w io.Writer, scene Scene, format string) error {
+	root, err := encodeScene(scene)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case SceneYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(root); err != nil {
+			return err
+		}
+		return enc.Close()
+	case SceneJSON:
+		buf := new(bytes.Buffer)
+		writeNodeJSON(buf, root, "")
+		buf.WriteByte('\n')
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	return fmt.Errorf("unknown scene format %q", format)
+}
+
+// Save a scene as JSON or YAML, by the file's extension.
+func SaveScene(path string, scene Scene) error {
+	var format string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		format = SceneJSON
+	case ".yaml", ".yml":
+		format = SceneYAML
+	default:
+		return fmt.Errorf("%s: scenes are .yaml, .yml or .json", path)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteScene(buf, scene, format); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func decodeSceneNode(n *yaml.Node) (Scene, error) {
+	var scene Scene
+	if n.Kind != yaml.MappingNode {
+		return scene, sceneFail(n, "", "want a mapping of scene settings")
+	}
+
+	keys := map[string]*yaml.Node{}
+	for i := 0; i < len(n.Content); i += 2 {
+		keys[n.Content[i].Value] = n.Content[i+1]
+	}
+
+	version, ok := keys["version"]
+	if !ok {
+		return scene, sceneFail(n, "", "missing version; this build reads version %d", sceneVersion)
+	}
+	if version.Value != strconv.Itoa(sceneVersion) {
+		return scene, sceneFail(version, "version", "unsupported version %s; this build reads version %d", version.Value, sceneVersion)
+	}
+
+	settings := map[string]sceneField{}
+	var names []string
+	for _, f := range sceneSettings() {
+		settings[f.name] = f
+		names = append(names, f.name)
+	}
+	names = append(names, "version", "camera", "stuff")
+
+	v := reflect.ValueOf(&scene).Elem()
+	for i := 0; i < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		switch key.Value {
+		case "version":
+		case "camera":
+			camera, err := decodeCamera(value)
+			if err != nil {
+				return scene, err
+			}
+			scene.Camera = camera
+		case "stuff":
+			if err := decodeValue(value, v.FieldByName("Stuff"), "stuff"); err != nil {
+				return scene, err
+			}
+		default:
+			f, ok := settings[key.Value]
+			if !ok {
+				return scene, sceneFail(key, "", "unknown setting %q%s", key.Value, suggest(key.Value, names))
+			}
+			if err := decodeValue(value, v.FieldByIndex(f.index), f.name); err != nil {
+				return scene, err
+			}
+		}
+	}
+
+	size := func(key string, pixels int) error {
+		if pixels > 0 {
+			return nil
+		}
+		if value, ok := keys[key]; ok {
+			return sceneFail(value, key, "must be at least 1")
+		}
+		return sceneFail(n, "", "missing %s", key)
+	}
+	if err := size("width", scene.Width); err != nil {
+		return scene, err
+	}
+	if err := size("height", scene.Height); err != nil {
+		return scene, err
+	}
+	if scene.Samples < 0 || scene.Samples > MaxSamples {
+		return scene, sceneFail(keys["samples"], "samples", "must be 0 to %d", MaxSamples)
+	}
+	if _, ok := keys["camera"]; !ok {
+		return scene, sceneFail(n, "", "missing camera")
+	}
+	if len(scene.Stuff) == 0 {
+		if value, ok := keys["stuff"]; ok {
+			return scene, sceneFail(value, "stuff", "nothing to render")
+		}
+		return scene, sceneFail(n, "", "missing stuff")
+	}
+	return scene, nil
+}
+
+func decodeCamera(n *yaml.Node) (Camera, error) {
+	var c sceneCamera
+	if err := decodeValue(n, reflect.ValueOf(&c).Elem(), "camera"); err != nil {
+		return Camera{}, err
+	}
+	switch {
+	case c.LookAt == c.LookFrom:
+		return Camera{}, sceneFail(n, "camera", "lookAt must differ from lookFrom")
+	case c.Up.Cross(c.LookAt.Sub(c.LookFrom)).Length() == 0:
+		return Camera{}, sceneFail(n, "camera", "up must not be zero or parallel to the view")
+	case c.Fov <= 0 || c.Fov >= 180:
+		return Camera{}, sceneFail(n, "camera", "fov must be between 0 and 180 degrees")
+	}
+	return NewCamera(c.LookFrom, c.LookAt, c.Up, c.Fov, c.Focus, c.Aperture), nil
+}
+
+// the inverse of NewCamera, near enough
+func encodeCamera(c Camera) sceneCamera {
+	// any point along the view will do, so look at the focus if there is one
+	distance := c.Focus
+	if distance <= 0 {
+		distance = 1
+	}
+	return sceneCamera{
+		LookFrom: c.Origin,
+		LookAt:   c.Origin.Add(c.W.Scale(distance)),
+		Up:       c.V,
+		Fov:      math.Atan(1/c.M) * 360 / math.Pi,
+		Focus:    c.Origin.Add(c.W.Scale(c.Focus)),
+		Aperture: c.Aperture,
+	}
+}
+
+func decodeValue(n *yaml.Node, v reflect.Value, path string) error {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	t := v.Type()
+
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int32, reflect.Int64, reflect.Bool, reflect.String:
+		return decodeScalar(n, v, path, true)
+
+	case reflect.Interface:
+		return decodeInterface(n, v, path)
+
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return sceneFail(n, path, "want a list")
+		}
+		if t.Elem().Kind() == reflect.Interface && len(n.Content) == 0 {
+			return sceneFail(n, path, "want at least one item")
+		}
+		s := reflect.MakeSlice(t, len(n.Content), len(n.Content))
+		for i, item := range n.Content {
+			if err := decodeValue(item, s.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+
+	case reflect.Array:
+		if n.Kind != yaml.SequenceNode || len(n.Content) != t.Len() {
+			return sceneFail(n, path, "want a list of %d", t.Len())
+		}
+		for i, item := range n.Content {
+			if err := decodeValue(item, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return sceneFail(n, path, "want a mapping")
+		}
+		m := reflect.MakeMap(t)
+		for i := 0; i < len(n.Content); i += 2 {
+			key := reflect.New(t.Key()).Elem()
+			// JSON keys are always strings
+			if err := decodeScalar(n.Content[i], key, path, false); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := decodeValue(n.Content[i+1], value, fmt.Sprintf("%s[%s]", path, n.Content[i].Value)); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+
+	case reflect.Struct:
+		if isVector(t) {
+			if n.Kind != yaml.SequenceNode || len(n.Content) != t.NumField() {
+				return sceneFail(n, path, "want a list of %d numbers", t.NumField())
+			}
+			for i, item := range n.Content {
+				if err := decodeScalar(item, v.Field(i), fmt.Sprintf("%s[%d]", path, i), true); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if t == thingType {
+			return decodeThing(n, v, path)
+		}
+		return decodeStruct(n, v, path)
+	}
+	return sceneFail(n, path, "can't read a %s", t)
+}
+
+// A scalar. Strict checks YAML's idea of its type as well, so "1" is not
+// taken for a number.
+func decodeScalar(n *yaml.Node, v reflect.Value, path string, strict bool) error {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != yaml.ScalarNode {
+		return sceneFail(n, path, "want a %s", scalarName(v.Kind()))
+	}
+	tag := n.ShortTag()
+	wrong := func() error {
+		return sceneFail(n, path, "want a %s, got %q", scalarName(v.Kind()), n.Value)
+	}
+
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if strict && tag != "!!int" && tag != "!!float" {
+			return wrong()
+		}
+		f, err := strconv.ParseFloat(n.Value, v.Type().Bits())
+		if err != nil {
+			return wrong()
+		}
+		v.SetFloat(f)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if strict && tag != "!!int" {
+			return wrong()
+		}
+		i, err := strconv.ParseInt(n.Value, 0, 64)
+		if err != nil || v.OverflowInt(i) {
+			return wrong()
+		}
+		v.SetInt(i)
+	case reflect.Bool:
+		if strict && tag != "!!bool" {
+			return wrong()
+		}
+		b, err := strconv.ParseBool(n.Value)
+		if err != nil {
+			return wrong()
+		}
+		v.SetBool(b)
+	case reflect.String:
+		v.SetString(n.Value)
+	}
+	return nil
+}
+
+func scalarName(k reflect.Kind) string {
+	switch k {
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "whole number"
+	case reflect.Bool:
+		return "true or false"
+	}
+	return "string"
+}
+
+func decodeStruct(n *yaml.Node, v reflect.Value, path string) error {
+	if n.Kind != yaml.MappingNode {
+		return sceneFail(n, path, "want a mapping")
+	}
+	fields := map[string]sceneField{}
+	var names []string
+	for _, f := range sceneFields(v.Type()) {
+		fields[f.name] = f
+		names = append(names, f.name)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		f, ok := fields[key.Value]
+		if !ok {
+			return sceneFail(key, path, "unknown field %q%s (fields: %s)", key.Value, suggest(key.Value, names), strings.Join(names, ", "))
+		}
+		if err := decodeValue(value, v.FieldByIndex(f.index), child(path, f.name)); err != nil {
+			return err
+		}
+		seen[f.name] = true
+	}
+
+	// nested shapes and materials have no sensible zero value
+	for _, name := range names {
+		if f := fields[name]; f.typ.Kind() == reflect.Interface && !isOptional(f.typ) && !seen[name] {
+			return sceneFail(n, path, "missing %s", name)
+		}
+	}
+	return nil
+}
+
+func decodeThing(n *yaml.Node, v reflect.Value, path string) error {
+	if n.Kind != yaml.MappingNode {
+		return sceneFail(n, path, "want a mapping with material and sdf")
+	}
+	var thing Thing
+	seen := map[string]bool{}
+	for i := 0; i < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		var err error
+		switch key.Value {
+		case "material":
+			err = decodeValue(value, reflect.ValueOf(&thing.Mat).Elem(), child(path, "material"))
+		case "sdf":
+			err = decodeValue(value, reflect.ValueOf(&thing.SDF3).Elem(), child(path, "sdf"))
+		default:
+			err = sceneFail(key, path, "unknown field %q%s (fields: material, sdf)", key.Value, suggest(key.Value, []string{"material", "sdf"}))
+		}
+		if err != nil {
+			return err
+		}
+		seen[key.Value] = true
+	}
+	for _, name := range []string{"material", "sdf"} {
+		if !seen[name] {
+			return sceneFail(n, path, "missing %s", name)
+		}
+	}
+	v.Set(reflect.ValueOf(thing))
+	return nil
+}
+
+// the types a scene may name in place of iface
+func sceneChoices(iface reflect.Type) []string {
+	var names []string
+	for name, t := range sceneTypes {
+		if t.Implements(iface) || (iface == sdf3Type && t.Implements(shorthandType)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func ifaceName(iface reflect.Type) string {
+	switch iface {
+	case sdf2Type:
+		return "2D shape"
+	case sdf3Type:
+		return "3D shape"
+	case toneType:
+		return "tone map"
+	case filterType:
+		return "filter"
+	case samplerType:
+		return "sampler"
+	}
+	return "material"
+}
+
+func decodeInterface(n *yaml.Node, v reflect.Value, path string) error {
+	iface := v.Type()
+	choices := sceneChoices(iface)
+
+	if iface == materialType && n.Kind == yaml.ScalarNode {
+		mat, ok := sceneMetals[n.Value]
+		if !ok {
+			var metals []string
+			for name := range sceneMetals {
+				metals = append(metals, name)
+			}
+			sort.Strings(metals)
+			return sceneFail(n, path, "unknown material %q%s (named materials: %s)", n.Value, suggest(n.Value, metals), strings.Join(metals, ", "))
+		}
+		v.Set(reflect.ValueOf(mat))
+		return nil
+	}
+
+	// tone maps, filters and samplers are often just a name
+	if isOptional(iface) && n.Kind == yaml.ScalarNode {
+		t, ok := sceneTypes[n.Value]
+		if !ok || !t.Implements(iface) {
+			return sceneFail(n, path, "unknown %s %q%s (%ss: %s)", ifaceName(iface), n.Value, suggest(n.Value, choices), ifaceName(iface), strings.Join(choices, ", "))
+		}
+		v.Set(reflect.New(t).Elem())
+		return nil
+	}
+
+	if n.Kind != yaml.MappingNode || len(n.Content) != 2 {
+		return sceneFail(n, path, "want a %s: a mapping with one key naming its type, such as %s", ifaceName(iface), choices[0])
+	}
+	key, value := n.Content[0], n.Content[1]
+	t, ok := sceneTypes[key.Value]
+	if !ok {
+		return sceneFail(key, path, "unknown %s %q%s", ifaceName(iface), key.Value, suggest(key.Value, choices))
+	}
+	if !t.Implements(iface) && !(iface == sdf3Type && t.Implements(shorthandType)) {
+		for _, other := range []reflect.Type{sdf2Type, sdf3Type, materialType, toneType, filterType, samplerType} {
+			if t.Implements(other) {
+				return sceneFail(key, path, "want a %s, but %s is a %s", ifaceName(iface), key.Value, ifaceName(other))
+			}
+		}
+		return sceneFail(key, path, "want a %s, not %s", ifaceName(iface), key.Value)
+	}
+
+	item := reflect.New(t).Elem()
+	if err := decodeValue(value, item, child(path, key.Value)); err != nil {
+		return err
+	}
+	if s, ok := item.Interface().(sceneShorthand); ok {
+		v.Set(reflect.ValueOf(s.expand()))
+		return nil
+	}
+	v.Set(item)
+	return nil
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func mappingNode(pairs ...*yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Content: pairs}
+}
+
+func encodeScene(scene Scene) (*yaml.Node, error) {
+	root := mappingNode(stringNode("version"), scalarNode(strconv.Itoa(sceneVersion)))
+
+	v := reflect.ValueOf(scene)
+	for _, f := range sceneSettings() {
+		if isOptional(f.typ) && v.FieldByIndex(f.index).IsNil() {
+			continue
+		}
+		value, err := encodeValue(v.FieldByIndex(f.index), f.name)
+		if err != nil {
+			return nil, err
+		}
+		root.Content = append(root.Content, stringNode(f.name), value)
+	}
+
+	camera, err := encodeValue(reflect.ValueOf(encodeCamera(scene.Camera)), "camera")
+	if err != nil {
+		return nil, err
+	}
+	camera.Style = yaml.FlowStyle
+	stuff, err := encodeValue(reflect.ValueOf(scene.Stuff), "stuff")
+	if err != nil {
+		return nil, err
+	}
+	root.Content = append(root.Content, stringNode("camera"), camera, stringNode("stuff"), stuff)
+	return root, nil
+}
+
+func encodeValue(v reflect.Value, path string) (*yaml.Node, error) {
+	t := v.Type()
+
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%s: can't save %v", path, f)
+		}
+		return scalarNode(strconv.FormatFloat(f, 'g', -1, t.Bits())), nil
+
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return scalarNode(strconv.FormatInt(v.Int(), 10)), nil
+
+	case reflect.Bool:
+		return scalarNode(strconv.FormatBool(v.Bool())), nil
+
+	case reflect.String:
+		return stringNode(v.String()), nil
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, fmt.Errorf("%s: nothing to save", path)
+		}
+		item := v.Elem()
+		if s, ok := item.Interface().(SDFTransform); ok {
+			item = reflect.ValueOf(shorten(s))
+		}
+		name, ok := sceneNames[item.Type()]
+		if !ok {
+			return nil, fmt.Errorf("%s: can't save a %s", path, item.Type())
+		}
+		if isOptional(t) && item.IsZero() {
+			return stringNode(name), nil
+		}
+		value, err := encodeValue(item, child(path, name))
+		if err != nil {
+			return nil, err
+		}
+		return mappingNode(stringNode(name), value), nil
+
+	case reflect.Slice, reflect.Array:
+		n := &yaml.Node{Kind: yaml.SequenceNode}
+		for i := 0; i < v.Len(); i++ {
+			item, err := encodeValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, item)
+		}
+		if k := t.Elem().Kind(); k != reflect.Interface && k != reflect.Struct && k != reflect.Slice && k != reflect.Array {
+			n.Style = yaml.FlowStyle
+		}
+		return n, nil
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		n := mappingNode()
+		for _, key := range keys {
+			value, err := encodeValue(v.MapIndex(key), fmt.Sprintf("%s[%v]", path, key))
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, stringNode(fmt.Sprint(key)), value)
+		}
+		return n, nil
+
+	case reflect.Struct:
+		if isVector(t) {
+			n := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for i := 0; i < t.NumField(); i++ {
+				item, err := encodeValue(v.Field(i), fmt.Sprintf("%s[%d]", path, i))
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, item)
+			}
+			return n, nil
+		}
+		if t == thingType {
+			thing := v.Interface().(Thing)
+			mat, err := encodeValue(reflect.ValueOf(&thing.Mat).Elem(), child(path, "material"))
+			if err != nil {
+				return nil, err
+			}
+			sdf, err := encodeValue(reflect.ValueOf(&thing.SDF3).Elem(), child(path, "sdf"))
+			if err != nil {
+				return nil, err
+			}
+			return mappingNode(stringNode("material"), mat, stringNode("sdf"), sdf), nil
+		}
+		n := mappingNode()
+		for _, f := range sceneFields(t) {
+			if isOptional(f.typ) && v.FieldByIndex(f.index).IsNil() {
+				continue
+			}
+			value, err := encodeValue(v.FieldByIndex(f.index), child(path, f.name))
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, stringNode(f.name), value)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("%s: can't save a %s", path, t)
+}
+
+// a transform as a translation, when that's all it is
+func shorten(s SDFTransform) interface{} {
+	m := s.M
+	if m.X00 == 1 && m.X01 == 0 && m.X02 == 0 &&
+		m.X10 == 0 && m.X11 == 1 && m.X12 == 0 &&
+		m.X20 == 0 && m.X21 == 0 && m.X22 == 1 &&
+		m.X30 == 0 && m.X31 == 0 && m.X32 == 0 && m.X33 == 1 {
+		return sceneTranslate{V3(m.X03, m.X13, m.X23), s.SDF3}
+	}
+	return sceneTransform{s.M, s.SDF3}
+}
+
+// JSON from the same nodes as YAML, with lists of numbers on one line
+func writeNodeJSON(buf *bytes.Buffer, n *yaml.Node, indent string) {
+	inner := indent + "  "
+	switch n.Kind {
+	case yaml.MappingNode:
+		if len(n.Content) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteString("{\n")
+		for i := 0; i < len(n.Content); i += 2 {
+			buf.WriteString(inner)
+			writeNodeJSON(buf, n.Content[i], inner)
+			buf.WriteString(": ")
+			writeNodeJSON(buf, n.Content[i+1], inner)
+			if i+2 < len(n.Content) {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "}")
+	case yaml.SequenceNode:
+		if len(n.Content) == 0 || n.Style == yaml.FlowStyle {
+			buf.WriteByte('[')
+			for i, item := range n.Content {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				writeNodeJSON(buf, item, inner)
+			}
+			buf.WriteByte(']')
+			return
+		}
+		buf.WriteString("[\n")
+		for i, item := range n.Content {
+			buf.WriteString(inner)
+			writeNodeJSON(buf, item, inner)
+			if i+1 < len(n.Content) {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "]")
+	default:
+		if n.Tag == "!!str" {
+			quoted, _ := json.Marshal(n.Value)
+			buf.Write(quoted)
+			return
+		}
+		buf.WriteString(n.Value)
+	}
+}
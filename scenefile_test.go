@@ -0,0 +1,306 @@
+package spt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sameCamera(a, b Camera) bool {
+	close := func(x, y float64) bool {
+		return math.Abs(x-y) <= 1e-9*math.Max(1, math.Abs(x))
+	}
+	vclose := func(x, y Vec3) bool {
+		return close(x.X, y.X) && close(x.Y, y.Y) && close(x.Z, y.Z)
+	}
+	return vclose(a.Origin, b.Origin) && vclose(a.U, b.U) && vclose(a.V, b.V) && vclose(a.W, b.W) &&
+		close(a.M, b.M) && close(a.Focus, b.Focus) && close(a.Aperture, b.Aperture)
+}
+
+func checkSameScene(t *testing.T, name string, want, got Scene) {
+	if !sameCamera(want.Camera, got.Camera) {
+		t.Errorf("%s: camera %+v, want %+v", name, got.Camera, want.Camera)
+	}
+	got.Camera = want.Camera
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s: scene differs after a round trip", name)
+		for i := range want.Stuff {
+			if i < len(got.Stuff) && !reflect.DeepEqual(want.Stuff[i], got.Stuff[i]) {
+				t.Errorf("%s: stuff[%d] %#v, want %#v", name, i, got.Stuff[i], want.Stuff[i])
+				break
+			}
+		}
+	}
+}
+
+func TestSceneRoundTrip(t *testing.T) {
+	scene := testScene()
+	scene.Adaptive = true
+	scene.Noise = 0.02
+
+	for _, format := range []string{SceneYAML, SceneJSON} {
+		buf := new(bytes.Buffer)
+		if err := WriteScene(buf, scene, format); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := ReadScene(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		checkSameScene(t, format, scene, loaded)
+	}
+
+	dir, err := ioutil.TempDir("", "spt-scene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"scene.yaml", "scene.yml", "scene.json"} {
+		path := filepath.Join(dir, name)
+		if err := SaveScene(path, scene); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadScene(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSameScene(t, name, scene, loaded)
+	}
+	if err := SaveScene(filepath.Join(dir, "scene.txt"), scene); err == nil {
+		t.Error("saved a scene as .txt")
+	}
+}
+
+// A value of t with every field set, and nested shapes kept small.
+func sampleValue(t reflect.Type, n *int) reflect.Value {
+	*n++
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(*n) + 0.1)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(*n))
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Interface:
+		switch t {
+		case sdf2Type:
+			v.Set(reflect.ValueOf(Circle(float64(*n))))
+		case sdf3Type:
+			v.Set(reflect.ValueOf(Sphere(float64(*n))))
+		case materialType:
+			v.Set(reflect.ValueOf(Matt(Color{0.1, 0.2, float64(*n) / 100})))
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(t, 2, 2))
+		for i := 0; i < 2; i++ {
+			v.Index(i).Set(sampleValue(t.Elem(), n))
+		}
+	case reflect.Array:
+		for i := 0; i < t.Len(); i++ {
+			v.Index(i).Set(sampleValue(t.Elem(), n))
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(t))
+		v.SetMapIndex(sampleValue(t.Key(), n), sampleValue(t.Elem(), n))
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath == "" {
+				v.Field(i).Set(sampleValue(t.Field(i).Type, n))
+			}
+		}
+	}
+	return v
+}
+
+// every type a scene can name survives a round trip
+func TestSceneTypes(t *testing.T) {
+	scene := tinyScene()
+	scene.Stuff = nil
+	n := 0
+	for name, typ := range sceneTypes {
+		if typ.Implements(shorthandType) || typ.Implements(toneType) || typ.Implements(filterType) || typ.Implements(samplerType) {
+			continue
+		}
+		value := sampleValue(typ, &n).Interface()
+		thing := Object(Matt(White), Sphere(1))
+		switch v := value.(type) {
+		case SDF2:
+			thing.SDF3 = Extrude(1, v)
+		case SDF3:
+			thing.SDF3 = v
+		case Material:
+			thing.Mat = v
+		default:
+			t.Fatalf("%s is a %T", name, value)
+		}
+		scene.Stuff = append(scene.Stuff, thing)
+	}
+	// transforms take another route
+	scene.Stuff = append(scene.Stuff,
+		Object(Steel, Translate(V3(1, 2, 3), Sphere(1))),
+		Object(Gold, RotateX(30, Translate(V3(1, 2, 3), Sphere(1)))),
+	)
+
+	for _, format := range []string{SceneYAML, SceneJSON} {
+		buf := new(bytes.Buffer)
+		if err := WriteScene(buf, scene, format); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := ReadScene(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		checkSameScene(t, format, scene, loaded)
+	}
+}
+
+func TestSceneDisplay(t *testing.T) {
+	scene := tinyScene()
+	for _, tone := range []ToneMap{nil, Clip{}, ACES{}, Reinhard{4}, Hable{}} {
+		scene.Display = Display{Exposure: -1.5, Balance: Color{1, 0.9, 0.8}, Tone: tone}
+		for _, format := range []string{SceneYAML, SceneJSON} {
+			buf := new(bytes.Buffer)
+			if err := WriteScene(buf, scene, format); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := ReadScene(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			checkSameScene(t, format, scene, loaded)
+		}
+	}
+
+	scene, err := ReadScene(strings.NewReader(`
+version: 1
+width: 32
+height: 18
+display: {exposure: 1, tone: aces}
+camera: {lookFrom: [0, -10, 0], lookAt: [0, 0, 0], up: [0, 0, 1], fov: 40, focus: [0, 0, 0], aperture: 0}
+stuff: [{material: steel, sdf: {sphere: {r: 1}}}]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scene.Display != (Display{Exposure: 1, Tone: ACES{}}) {
+		t.Errorf("display %+v", scene.Display)
+	}
+}
+
+func TestSceneSampling(t *testing.T) {
+	scene := tinyScene()
+	for i, filter := range append([]Filter{nil}, testFilters...) {
+		scene.Filter = filter
+		scene.Sampler = nil
+		if i > 0 {
+			scene.Sampler = testSamplers[i%len(testSamplers)]
+		}
+		for _, format := range []string{SceneYAML, SceneJSON} {
+			buf := new(bytes.Buffer)
+			if err := WriteScene(buf, scene, format); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := ReadScene(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			checkSameScene(t, format, scene, loaded)
+		}
+	}
+
+	scene, err := ReadScene(strings.NewReader(`
+version: 1
+width: 32
+height: 18
+filter: mitchell
+sampler: blueNoise
+camera: {lookFrom: [0, -10, 0], lookAt: [0, 0, 0], up: [0, 0, 1], fov: 40, focus: [0, 0, 0], aperture: 0}
+stuff: [{material: steel, sdf: {sphere: {r: 1}}}]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scene.Filter != (Mitchell{}) || scene.Sampler != (BlueNoise{}) {
+		t.Errorf("filter %#v, sampler %#v", scene.Filter, scene.Sampler)
+	}
+}
+
+func TestSceneShorthand(t *testing.T) {
+	scene, err := ReadScene(strings.NewReader(`
+version: 1
+width: 32
+height: 18
+camera: {lookFrom: [0, -10, 0], lookAt: [0, 0, 0], up: [0, 0, 1], fov: 40, focus: [0, 0, 0], aperture: 0}
+stuff:
+  - material: steel
+    sdf:
+      rotate:
+        axis: [1, 0, 0]
+        degrees: 90
+        sdf: &ball {sphere: {r: 2}}
+  - material: {emitter: {color: [1, 1, 1]}}
+    sdf: {translate: {offset: [0, 0, 5], sdf: *ball}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Thing{
+		Object(Steel, RotateX(90, Sphere(2))),
+		Object(Light(White), TranslateZ(5, Sphere(2))),
+	}
+	if !reflect.DeepEqual(scene.Stuff, want) {
+		t.Errorf("stuff %#v", scene.Stuff)
+	}
+	if want := NewCamera(V3(0, -10, 0), Zero3, V3(0, 0, 1), 40, Zero3, 0); !sameCamera(scene.Camera, want) {
+		t.Errorf("camera %+v", scene.Camera)
+	}
+}
+
+func TestSceneErrors(t *testing.T) {
+	head := "version: 1\nwidth: 32\nheight: 18\ncamera: {lookFrom: [0, -10, 0], lookAt: [0, 0, 0], up: [0, 0, 1], fov: 40, focus: [0, 0, 0], aperture: 0}\n"
+	for _, c := range []struct {
+		scene, want string
+	}{
+		{"width: 32\n", "1:1: missing version; this build reads version 1"},
+		{"version: 2\n", "1:10: version: unsupported version 2; this build reads version 1"},
+		{head + "stuff: []\n", "5:8: stuff: nothing to render"},
+		{head + "samples: 70000\n", "5:10: samples: must be 0 to 65535"},
+		{head + "widht: 3\n", `5:1: unknown setting "widht"; did you mean width?`},
+		{head + "stuff:\n  - material: steel\n    sdf: {spere: {r: 1}}\n", `7:11: stuff[0].sdf: unknown 3D shape "spere"; did you mean sphere?`},
+		{head + "stuff:\n  - material: steel\n    sdf: {circle: {radius: 1}}\n", "7:11: stuff[0].sdf: want a 3D shape, but circle is a 2D shape"},
+		{head + "stuff:\n  - material: steel\n    sdf: {sphere: {r: big}}\n", `7:23: stuff[0].sdf.sphere.r: want a number, got "big"`},
+		{head + "stuff:\n  - material: steel\n    sdf: {sphere: {radius: 1}}\n", `7:20: stuff[0].sdf.sphere: unknown field "radius" (fields: r)`},
+		{head + "stuff:\n  - material: steel\n    sdf: {union: {items: [{sphere: {r: 1}}, {rounded: {radius: 1}}]}}\n", "7:55: stuff[0].sdf.union.items[1].rounded: missing sdf"},
+		{head + "stuff:\n  - material: stell\n    sdf: {sphere: {r: 1}}\n", `6:15: stuff[0].material: unknown material "stell"; did you mean steel? (named materials: brass, copper, gold, stainless, steel)`},
+		{head + "stuff:\n  - sdf: {sphere: {r: 1}}\n", "6:5: stuff[0]: missing material"},
+		{head + "stuff:\n  - material: steel\n    sdf: {translate: {offset: [1, 2], sdf: {sphere: {r: 1}}}}\n", "7:31: stuff[0].sdf.translate.offset: want a list of 3 numbers"},
+		{head + "display: {tone: hables}\n", `5:17: display.tone: unknown tone map "hables"; did you mean hable? (tone maps: aces, clip, hable, reinhard)`},
+		{head + "display: {tone: {circle: {r: 1}}}\n", "5:18: display.tone: want a tone map, but circle is a 2D shape"},
+		{head + "filter: gausian\n", `5:9: filter: unknown filter "gausian"; did you mean gaussian? (filters: box, gaussian, lanczos, mitchell, tent)`},
+		{head + "filter: {aces: {}}\n", "5:10: filter: want a filter, but aces is a tone map"},
+		{"{\n  \"version\": 1,\n  \"width\": \"32\"\n}\n", `3:12: width: want a whole number, got "32"`},
+	} {
+		_, err := ReadScene(strings.NewReader(c.scene))
+		if err == nil || err.Error() != c.want {
+			t.Errorf("got %v\nwant %s", err, c.want)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "spt-scene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bad.yaml")
+	ioutil.WriteFile(path, []byte("version: 2\n"), 0644)
+	if _, err := LoadScene(path); err == nil || !strings.HasPrefix(err.Error(), path+":1:10: ") {
+		t.Errorf("load: %v", err)
+	}
+}
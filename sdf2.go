@@ -36,6 +36,10 @@ func (s SDFCircle) Circle() (Vec2, float64) {
 	return Zero2, s.Radius
 }
 
+func (s SDFCircle) Rect() (Vec2, Vec2) {
+	return V2(-s.Radius, -s.Radius), V2(s.Radius, s.Radius)
+}
+
 func Circle(radius float64) SDF2 {
 	return SDFCircle{radius}
 }
@@ -55,6 +59,10 @@ func (s SDFRectangle) Circle() (Vec2, float64) {
 	return Zero2, sqrt(s.X*s.X + s.Y*s.Y)
 }
 
+func (s SDFRectangle) Rect() (Vec2, Vec2) {
+	return V2(-s.X, -s.Y), V2(s.X, s.Y)
+}
+
 func Rectangle(x, y float64) SDF2 {
 	return SDFRectangle{x / 2, y / 2}
 }
@@ -87,6 +95,10 @@ func (s SDFTriangle) Circle() (Vec2, float64) {
 	return Zero2, max(max(len2(s.P0), len2(s.P1)), len2(s.P2))
 }
 
+func (s SDFTriangle) Rect() (Vec2, Vec2) {
+	return min2(s.P0, min2(s.P1, s.P2)), max2(s.P0, max2(s.P1, s.P2))
+}
+
 func Triangle(p0, p1, p2 Vec2) SDF2 {
 	return SDFTriangle{p0, p1, p2}
 }
@@ -119,6 +131,10 @@ func (s SDFPolygon) Circle() (Vec2, float64) {
 	return Zero2, s.R * 2
 }
 
+func (s SDFPolygon) Rect() (Vec2, Vec2) {
+	return V2(-s.R, -s.R), V2(s.R, s.R)
+}
+
 func Polygon(n int, r float64) SDF2 {
 	return SDFPolygon{n, r}
 }
@@ -147,6 +163,11 @@ func (s SDFStadium) Circle() (Vec2, float64) {
 	return Zero2, s.H + s.R1 + s.R2
 }
 
+func (s SDFStadium) Rect() (Vec2, Vec2) {
+	r := max(s.R1, s.R2)
+	return V2(-r, -s.R1), V2(r, s.H+s.R2)
+}
+
 func Stadium(h, r1, r2 float64) SDF2 {
 	return SDFStadium{h, r1, r2}
 }
@@ -193,6 +214,11 @@ func (s SDFParabola) Circle() (Vec2, float64) {
 	return Zero2, r
 }
 
+func (s SDFParabola) Rect() (Vec2, Vec2) {
+	x := sqrt(s.H / s.M)
+	return V2(-x, 0), V2(x, s.H)
+}
+
 // width on x-axis at height on y-axis
 func Parabola(w, h float64) SDF2 {
 	w = w / 2
@@ -221,6 +247,10 @@ func (s SDFHexagram) Circle() (Vec2, float64) {
 	return Zero2, s.R * 2
 }
 
+func (s SDFHexagram) Rect() (Vec2, Vec2) {
+	return V2(-s.R*2, -s.R*2), V2(s.R*2, s.R*2)
+}
+
 func Hexagram(r float64) SDF2 {
 	return SDFHexagram{r}
 }
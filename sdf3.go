@@ -55,6 +55,11 @@ func (s SDFExtrude) Sphere() (Vec3, float64) {
 	return Zero3.Add(V3(center.X, center.Y, 0)), sqrt(radius*radius + s.H*s.H)
 }
 
+func (s SDFExtrude) Bounds() (Vec3, Vec3) {
+	lo, hi := Rect(s.SDF2)
+	return V3(lo.X, lo.Y, -s.H), V3(hi.X, hi.Y, s.H)
+}
+
 func Extrude(h float64, sdf SDF2) SDF3 {
 	return SDFExtrude{h / 2, sdf}
 }
@@ -76,6 +81,12 @@ func (s SDFRevolve) Sphere() (Vec3, float64) {
 	return Zero3.Add(V3(center.X, center.Y, 0)), radius
 }
 
+func (s SDFRevolve) Bounds() (Vec3, Vec3) {
+	lo, hi := Rect(s.SDF2)
+	r := max(0, s.O+hi.X)
+	return V3(-r, lo.Y, -r), V3(r, hi.Y, r)
+}
+
 func Revolve(o float64, sdf SDF2) SDF3 {
 	return SDFRevolve{o, sdf}
 }
@@ -94,6 +105,10 @@ func (s SDFSphere) Sphere() (Vec3, float64) {
 	return Zero3, s.R
 }
 
+func (s SDFSphere) Bounds() (Vec3, Vec3) {
+	return V3(-s.R, -s.R, -s.R), V3(s.R, s.R, s.R)
+}
+
 func Sphere(r float64) SDF3 {
 	return SDFSphere{r}
 }
@@ -114,6 +129,10 @@ func (s SDFCube) Sphere() (Vec3, float64) {
 	return Zero3, len3(V3(s.X, s.Y, s.Z))
 }
 
+func (s SDFCube) Bounds() (Vec3, Vec3) {
+	return V3(-s.X, -s.Y, -s.Z), V3(s.X, s.Y, s.Z)
+}
+
 func Cube(x, y, z float64) SDF3 {
 	return SDFCube{x / 2, y / 2, z / 2}
 }
@@ -150,6 +169,11 @@ func (s SDFTorus) Sphere() (Vec3, float64) {
 	return Zero3, s.V.X + s.V.Y
 }
 
+func (s SDFTorus) Bounds() (Vec3, Vec3) {
+	r := s.V.X + s.V.Y
+	return V3(-r, -s.V.Y, -r), V3(r, s.V.Y, r)
+}
+
 func Torus(x, y float64) SDF3 {
 	w := x - y
 	return SDFTorus{Vec2{x - w/2, w / 2}}
@@ -172,6 +196,10 @@ func (s SDFCone) Sphere() (Vec3, float64) {
 	return Zero3, sqrt(s.H*s.H + s.R*s.R)
 }
 
+func (s SDFCone) Bounds() (Vec3, Vec3) {
+	return V3(-s.R, -s.R, -s.H), V3(s.R, s.R, 0)
+}
+
 func Cone(h, r float64) SDF3 {
 	rad := math.Atan(h / r)
 	return TranslateZ(h/2, SDFCone{math.Sin(rad), math.Cos(rad), h, r})
@@ -205,6 +233,11 @@ func (s SDFRounded) Sphere() (Vec3, float64) {
 	return center, radius + s.Radius
 }
 
+func (s SDFRounded) Bounds() (Vec3, Vec3) {
+	lo, hi := Bounds(s.SDF3)
+	return boxGrow(lo, hi, s.Radius)
+}
+
 func Round(radius float64, sdf SDF3) SDF3 {
 	return SDFRounded{radius, sdf}
 }
@@ -226,6 +259,11 @@ func (s SDFHollow) Sphere() (Vec3, float64) {
 	return center, radius
 }
 
+func (s SDFHollow) Bounds() (Vec3, Vec3) {
+	lo, hi := Bounds(s.SDF3)
+	return boxGrow(lo, hi, s.Thickness)
+}
+
 func Hollow(thickness float64, sdf SDF3) SDF3 {
 	return SDFHollow{thickness, sdf}
 }
@@ -247,6 +285,12 @@ func (s SDFElongate) Sphere() (Vec3, float64) {
 	return center, radius + s.H.Length()
 }
 
+func (s SDFElongate) Bounds() (Vec3, Vec3) {
+	lo, hi := Bounds(s.SDF3)
+	h := abs3(s.H)
+	return lo.Sub(h), hi.Add(h)
+}
+
 func Elongate(x, y, z float64, sdf SDF3) SDF3 {
 	return SDFElongate{Vec3{x / 2, y / 2, z / 2}, sdf}
 }
@@ -283,6 +327,12 @@ func (s SDFRepeat) Sphere() (Vec3, float64) {
 	return center, V3(x, y, z).Length()
 }
 
+func (s SDFRepeat) Bounds() (Vec3, Vec3) {
+	lo, hi := Bounds(s.SDF3)
+	n := abs3(s.Count.Mul(s.Offset))
+	return lo.Sub(n), hi.Add(n)
+}
+
 func Repeat(cx, cy, cz, ox, oy, oz float64, sdf SDF3) SDF3 {
 	return SDFRepeat{Vec3{cx, cy, cz}, Vec3{ox, oy, oz}, sdf}
 }
@@ -304,6 +354,11 @@ func (s SDFEllipsoid) Sphere() (Vec3, float64) {
 	return Zero3, max(s.R.X, max(s.R.Y, s.R.Z)) * 2
 }
 
+func (s SDFEllipsoid) Bounds() (Vec3, Vec3) {
+	r := abs3(s.R)
+	return neg3(r), r
+}
+
 func Ellipsoid(x, y, z float64) SDF3 {
 	return SDFEllipsoid{Vec3{x, y, z}}
 }
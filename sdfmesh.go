@@ -0,0 +1,263 @@
+package spt
+
+import (
+	"encoding/gob"
+	"math"
+	"sort"
+)
+
+func init() {
+	gob.Register(SDFMesh{})
+}
+
+// A closed triangle mesh as a solid. Distance is exact, found by a
+// nearest-triangle search over a bounding volume hierarchy, and the sign
+// comes from angle-weighted pseudo-normals (Bærentzen & Aanæs 2005) so
+// the mesh must be watertight with consistent outward winding.
+type SDFMesh struct {
+	Facets []Facet
+}
+
+type meshTriangle struct {
+	a, b, c Vec3
+	// pseudo-normals for the face, edges ab, bc, ca, and vertices a, b, c
+	face   Vec3
+	edges  [3]Vec3
+	corner [3]Vec3
+}
+
+type meshNode struct {
+	lo, hi      Vec3
+	left, right int // children, or -1 for a leaf
+	start, end  int // leaf triangles
+}
+
+type meshTree struct {
+	nodes     []meshNode
+	triangles []meshTriangle
+}
+
+func newMeshTree(facets []Facet) *meshTree {
+	type edge [2]Vec3
+	key := func(a, b Vec3) edge {
+		if a.X < b.X || a.X == b.X && (a.Y < b.Y || a.Y == b.Y && a.Z < b.Z) {
+			return edge{a, b}
+		}
+		return edge{b, a}
+	}
+
+	edges := map[edge]Vec3{}
+	corners := map[Vec3]Vec3{}
+
+	for _, f := range facets {
+		n := f.Normal()
+		vs := [3]Vec3{f.A, f.B, f.C}
+		for i := 0; i < 3; i++ {
+			v, p, q := vs[i], vs[(i+1)%3], vs[(i+2)%3]
+			edges[key(v, p)] = edges[key(v, p)].Add(n)
+			// weight vertex normals by the incident angle
+			u, w := p.Sub(v), q.Sub(v)
+			angle := math.Acos(clamp(u.Dot(w)/(u.Length()*w.Length()), -1, 1))
+			if !math.IsNaN(angle) {
+				corners[v] = corners[v].Add(n.Scale(angle))
+			}
+		}
+	}
+
+	t := &meshTree{}
+	for _, f := range facets {
+		if f.Normal() == Zero3 {
+			continue // degenerate
+		}
+		t.triangles = append(t.triangles, meshTriangle{
+			a: f.A, b: f.B, c: f.C,
+			face:   f.Normal(),
+			edges:  [3]Vec3{edges[key(f.A, f.B)], edges[key(f.B, f.C)], edges[key(f.C, f.A)]},
+			corner: [3]Vec3{corners[f.A], corners[f.B], corners[f.C]},
+		})
+	}
+
+	if len(t.triangles) > 0 {
+		t.build(0, len(t.triangles))
+	}
+	return t
+}
+
+const meshLeafSize = 4
+
+func (t *meshTree) build(start, end int) int {
+	lo, hi := t.triangles[start].a, t.triangles[start].a
+	clo, chi := t.centroid(start), t.centroid(start)
+	for i := start; i < end; i++ {
+		tri := &t.triangles[i]
+		for _, v := range []Vec3{tri.a, tri.b, tri.c} {
+			lo, hi = min3(lo, v), max3(hi, v)
+		}
+		c := t.centroid(i)
+		clo, chi = min3(clo, c), max3(chi, c)
+	}
+
+	id := len(t.nodes)
+	t.nodes = append(t.nodes, meshNode{lo: lo, hi: hi, left: -1, right: -1, start: start, end: end})
+
+	if end-start <= meshLeafSize {
+		return id
+	}
+
+	// median split on the longest axis of the centroids
+	size := chi.Sub(clo)
+	axis := func(v Vec3) float64 { return v.X }
+	if size.Y > size.X && size.Y >= size.Z {
+		axis = func(v Vec3) float64 { return v.Y }
+	} else if size.Z > size.X && size.Z > size.Y {
+		axis = func(v Vec3) float64 { return v.Z }
+	}
+	sort.Slice(t.triangles[start:end], func(i, j int) bool {
+		return axis(t.centroid(start+i)) < axis(t.centroid(start+j))
+	})
+
+	mid := (start + end) / 2
+	left := t.build(start, mid)
+	right := t.build(mid, end)
+	t.nodes[id].left = left
+	t.nodes[id].right = right
+	return id
+}
+
+func (t *meshTree) centroid(i int) Vec3 {
+	tri := &t.triangles[i]
+	return tri.a.Add(tri.b).Add(tri.c).Scale(1.0 / 3)
+}
+
+func (t *meshTree) distance(p Vec3) float64 {
+	if len(t.nodes) == 0 {
+		return math.Inf(1)
+	}
+
+	best := math.Inf(1)
+	sign := 1.0
+	stack := make([]int, 0, 64)
+	stack = append(stack, 0)
+
+	for len(stack) > 0 {
+		node := &t.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+
+		if boxDistance2(p, node.lo, node.hi) >= best {
+			continue
+		}
+
+		if node.left < 0 {
+			for i := node.start; i < node.end; i++ {
+				tri := &t.triangles[i]
+				q, normal := tri.closest(p)
+				d := p.Sub(q)
+				if d2 := d.Dot(d); d2 < best {
+					best = d2
+					sign = 1.0
+					if d.Dot(normal) < 0 {
+						sign = -1.0
+					}
+				}
+			}
+			continue
+		}
+
+		// visit the nearer child first, so push it last
+		l, r := &t.nodes[node.left], &t.nodes[node.right]
+		if boxDistance2(p, l.lo, l.hi) < boxDistance2(p, r.lo, r.hi) {
+			stack = append(stack, node.right, node.left)
+		} else {
+			stack = append(stack, node.left, node.right)
+		}
+	}
+
+	return sign * math.Sqrt(best)
+}
+
+// Closest point on the triangle to p, and the pseudo-normal of the
+// feature (face, edge or vertex) it lies on. From Ericson, Real-Time
+// Collision Detection, 5.1.5.
+func (tri *meshTriangle) closest(p Vec3) (Vec3, Vec3) {
+	a, b, c := tri.a, tri.b, tri.c
+	ab, ac, ap := b.Sub(a), c.Sub(a), p.Sub(a)
+
+	d1, d2 := ab.Dot(ap), ac.Dot(ap)
+	if d1 <= 0 && d2 <= 0 {
+		return a, tri.corner[0]
+	}
+
+	bp := p.Sub(b)
+	d3, d4 := ab.Dot(bp), ac.Dot(bp)
+	if d3 >= 0 && d4 <= d3 {
+		return b, tri.corner[1]
+	}
+
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		return a.Add(ab.Scale(d1 / (d1 - d3))), tri.edges[0]
+	}
+
+	cp := p.Sub(c)
+	d5, d6 := ab.Dot(cp), ac.Dot(cp)
+	if d6 >= 0 && d5 <= d6 {
+		return c, tri.corner[2]
+	}
+
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		return a.Add(ac.Scale(d2 / (d2 - d6))), tri.edges[2]
+	}
+
+	va := d3*d6 - d5*d4
+	if va <= 0 && d4-d3 >= 0 && d5-d6 >= 0 {
+		return b.Add(c.Sub(b).Scale((d4 - d3) / ((d4 - d3) + (d5 - d6)))), tri.edges[1]
+	}
+
+	denom := 1.0 / (va + vb + vc)
+	v, w := vb*denom, vc*denom
+	return a.Add(ab.Scale(v)).Add(ac.Scale(w)), tri.face
+}
+
+func (s SDFMesh) SDF() func(Vec3) float64 {
+	tree := newMeshTree(s.Facets)
+	return tree.distance
+}
+
+func (s SDFMesh) Sphere() (Vec3, float64) {
+	if len(s.Facets) == 0 {
+		return Zero3, 0
+	}
+	lo, hi := s.Facets[0].A, s.Facets[0].A
+	for _, f := range s.Facets {
+		for _, v := range []Vec3{f.A, f.B, f.C} {
+			lo, hi = min3(lo, v), max3(hi, v)
+		}
+	}
+	center := lo.Add(hi).Scale(0.5)
+	radius := 0.0
+	for _, f := range s.Facets {
+		for _, v := range []Vec3{f.A, f.B, f.C} {
+			radius = max(radius, v.Sub(center).Length())
+		}
+	}
+	return center, radius
+}
+
+func (s SDFMesh) Bounds() (Vec3, Vec3) {
+	if len(s.Facets) == 0 {
+		return Zero3, Zero3
+	}
+	lo, hi := s.Facets[0].A, s.Facets[0].A
+	for _, f := range s.Facets {
+		for _, v := range []Vec3{f.A, f.B, f.C} {
+			lo, hi = min3(lo, v), max3(hi, v)
+		}
+	}
+	return lo, hi
+}
+
+// A solid from a closed triangle mesh, such as one from LoadMesh.
+func Polyhedron(mesh Mesh) SDF3 {
+	return SDFMesh{mesh.Facets}
+}
@@ -0,0 +1,115 @@
+package spt
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math/rand"
+	"testing"
+)
+
+// twelve triangles, wound counter-clockwise seen from outside
+func boxMesh(h Vec3) Mesh {
+	var mesh Mesh
+	corner := func(c int) Vec3 {
+		x, y, z := cornerOffset(c)
+		return V3(float64(x*2-1)*h.X, float64(y*2-1)*h.Y, float64(z*2-1)*h.Z)
+	}
+	for _, face := range [6][4]int{
+		{0, 4, 6, 2}, {1, 3, 7, 5}, {0, 1, 5, 4},
+		{2, 6, 7, 3}, {0, 2, 3, 1}, {4, 5, 7, 6},
+	} {
+		a, b, c, d := corner(face[0]), corner(face[1]), corner(face[2]), corner(face[3])
+		mesh.Facets = append(mesh.Facets, Facet{a, b, c}, Facet{a, c, d})
+	}
+	return mesh
+}
+
+func TestPolyhedron(t *testing.T) {
+	cube := Cube(800, 600, 400)
+	want := cube.SDF()
+
+	mesh := boxMesh(V3(400, 300, 200))
+	got := Polyhedron(mesh).SDF()
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		p := V3(rnd.Float64()*2000-1000, rnd.Float64()*2000-1000, rnd.Float64()*2000-1000)
+		if d, e := got(p), want(p); abs(d-e) > 1e-6 {
+			t.Fatalf("polyhedron at %v: %v != %v", p, d, e)
+		}
+	}
+
+	center, radius := Polyhedron(mesh).Sphere()
+	if center.Length() > 1e-6 || abs(radius-V3(400, 300, 200).Length()) > 1e-6 {
+		t.Errorf("polyhedron sphere %v %v", center, radius)
+	}
+}
+
+func TestPolyhedronSign(t *testing.T) {
+	// a marched sphere is curved everywhere, so the sign comes from
+	// edges and vertices as often as faces
+	sphere := Sphere(500)
+	got := Polyhedron(MarchingCubes(sphere, 16)).SDF()
+	want := sphere.SDF()
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		p := V3(rnd.Float64()*1200-600, rnd.Float64()*1200-600, rnd.Float64()*1200-600)
+		if e := want(p); abs(e) > 50 && (got(p) < 0) != (e < 0) {
+			t.Fatalf("polyhedron sign at %v: %v vs %v", p, got(p), e)
+		}
+	}
+}
+
+func TestPolyhedronFiles(t *testing.T) {
+	mesh := MarchingCubes(Sphere(100), 8)
+
+	for _, format := range []string{"stl", "ascii", "obj"} {
+		buf := new(bytes.Buffer)
+		var (
+			out Mesh
+			err error
+		)
+		switch format {
+		case "stl":
+			mesh.WriteSTL(buf)
+			out, err = ReadSTL(buf)
+		case "ascii":
+			mesh.WriteASCIISTL(buf)
+			out, err = ReadSTL(buf)
+		case "obj":
+			mesh.WriteOBJ(buf)
+			out, err = ReadOBJ(buf)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if len(out.Facets) != len(mesh.Facets) {
+			t.Fatalf("%s: read %d facets, want %d", format, len(out.Facets), len(mesh.Facets))
+		}
+		meshCheck(t, format, out, Sphere(100))
+	}
+
+	if _, err := ReadOBJ(bytes.NewBufferString("v 0 0 0\nv 1 0 0\nf 1 2 3\n")); err == nil {
+		t.Errorf("obj: out of range vertex accepted")
+	}
+}
+
+func TestPolyhedronGob(t *testing.T) {
+	in := Object(Steel, Translate(V3(100, 0, 0), Union(
+		Polyhedron(boxMesh(V3(50, 50, 50))),
+		Sphere(20),
+	)))
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	var out Thing
+	if err := gob.NewDecoder(buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	p := V3(180, 10, 10)
+	if d, e := in.SDF3.SDF()(p), out.SDF3.SDF()(p); d != e {
+		t.Errorf("polyhedron after gob: %v != %v", e, d)
+	}
+}
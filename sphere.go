@@ -8,3 +8,174 @@ type sphere struct {
 func (bs sphere) distance(p Vec3) float64 {
 	return p.Sub(bs.c).Length() - bs.r
 }
+
+// Bounded shapes offer an axis-aligned bounding box as well as a sphere.
+// Long thin shapes get enormous spheres, so where both are available the
+// renderer and combinators use whichever is tighter.
+type Bounded interface {
+	Bounds() (Vec3, Vec3)
+}
+
+// Bounded2 is the 2D equivalent of Bounded.
+type Bounded2 interface {
+	Rect() (Vec2, Vec2)
+}
+
+// Bounding box of any SDF3, falling back to the box around its sphere.
+func Bounds(s SDF3) (Vec3, Vec3) {
+	if b, ok := s.(Bounded); ok {
+		return b.Bounds()
+	}
+	c, r := s.Sphere()
+	return c.Sub(V3(r, r, r)), c.Add(V3(r, r, r))
+}
+
+// Bounding rectangle of any SDF2, falling back to the box around its circle.
+func Rect(s SDF2) (Vec2, Vec2) {
+	if b, ok := s.(Bounded2); ok {
+		return b.Rect()
+	}
+	c, r := s.Circle()
+	return c.Sub(V2(r, r)), c.Add(V2(r, r))
+}
+
+// The smaller of an item's bounding sphere and the sphere around its box.
+func itemSphere(s SDF3) (Vec3, float64) {
+	c, r := s.Sphere()
+	if b, ok := s.(Bounded); ok {
+		lo, hi := b.Bounds()
+		if br := hi.Sub(lo).Length() / 2; br < r {
+			return lo.Add(hi).Scale(0.5), br
+		}
+	}
+	return c, r
+}
+
+// Smallest sphere holding both spheres.
+func (a sphere) merge(b sphere) sphere {
+	d := b.c.Sub(a.c).Length()
+	if d+b.r <= a.r {
+		return a
+	}
+	if d+a.r <= b.r {
+		return b
+	}
+	r := (d + a.r + b.r) / 2
+	return sphere{a.c.Add(b.c.Sub(a.c).Scale((r - a.r) / d)), r}
+}
+
+// Radius needed at c to hold every sphere.
+func enclosing(c Vec3, spheres []sphere) (float64, int) {
+	radius, far := 0.0, 0
+	for i, s := range spheres {
+		if r := s.c.Sub(c).Length() + s.r; r > radius {
+			radius, far = r, i
+		}
+	}
+	return radius, far
+}
+
+// A near-minimal sphere around the items' spheres. Ritter's method gives
+// a first guess, then Bădoiu & Clarkson's iteration pulls the center
+// toward whichever sphere sticks out furthest, keeping the best seen.
+// The radius is always measured against every item, so the result
+// contains them all whatever the iteration count.
+func itemsBoundingSphere(items []SDF3) (Vec3, float64) {
+	if len(items) == 0 {
+		return Zero3, 0
+	}
+
+	spheres := make([]sphere, len(items))
+	for i, item := range items {
+		c, r := itemSphere(item)
+		spheres[i] = sphere{c, r}
+	}
+
+	// Ritter: grow to take in each sphere in turn, twice, so the second
+	// pass can correct for a poor starting order
+	best := spheres[0]
+	for pass := 0; pass < 2; pass++ {
+		for _, s := range spheres {
+			best = best.merge(s)
+		}
+	}
+	best.r, _ = enclosing(best.c, spheres)
+
+	center := best.c
+	for i := 1; i <= 64; i++ {
+		_, far := enclosing(center, spheres)
+		s := spheres[far]
+		// the point of the far sphere furthest from the center
+		dir := s.c.Sub(center)
+		if l := dir.Length(); l > 0 {
+			dir = dir.Scale(1 / l)
+		}
+		point := s.c.Add(dir.Scale(s.r))
+		center = center.Add(point.Sub(center).Scale(1 / float64(i+1)))
+		if r, _ := enclosing(center, spheres); r < best.r {
+			best = sphere{center, r}
+		}
+	}
+
+	return best.c, best.r
+}
+
+func itemsBoundsUnion(items []SDF3) (Vec3, Vec3) {
+	lo, hi := Bounds(items[0])
+	for _, item := range items[1:] {
+		l, h := Bounds(item)
+		lo, hi = min3(lo, l), max3(hi, h)
+	}
+	return lo, hi
+}
+
+func itemsBoundsIntersection(items []SDF3) (Vec3, Vec3) {
+	lo, hi := Bounds(items[0])
+	for _, item := range items[1:] {
+		l, h := Bounds(item)
+		lo, hi = max3(lo, l), min3(hi, h)
+	}
+	// disjoint items leave nothing, so collapse to a point
+	return lo, max3(lo, hi)
+}
+
+func boxGrow(lo, hi Vec3, n float64) (Vec3, Vec3) {
+	return lo.Sub(V3(n, n, n)), hi.Add(V3(n, n, n))
+}
+
+// squared distance from p to a box, zero inside
+func boxDistance2(p, lo, hi Vec3) float64 {
+	axis := func(p, lo, hi float64) float64 {
+		if p < lo {
+			return (lo - p) * (lo - p)
+		}
+		if p > hi {
+			return (p - hi) * (p - hi)
+		}
+		return 0
+	}
+	return axis(p.X, lo.X, hi.X) + axis(p.Y, lo.Y, hi.Y) + axis(p.Z, lo.Z, hi.Z)
+}
+
+// A bounding sphere and box together.
+type bound struct {
+	sphere
+	lo, hi Vec3
+}
+
+func itemBound(s SDF3) bound {
+	c, r := s.Sphere()
+	lo, hi := Bounds(s)
+	return bound{sphere{c, r}, lo, hi}
+}
+
+// a lower bound on the distance to anything inside, negative inside so
+// differences can trust it too
+func (b bound) distance(p Vec3) float64 {
+	box := sqrt(boxDistance2(p, b.lo, b.hi))
+	if box == 0 {
+		// nothing inside is deeper than the box's nearest face
+		box = -min(min(min(p.X-b.lo.X, b.hi.X-p.X), min(p.Y-b.lo.Y, b.hi.Y-p.Y)), min(p.Z-b.lo.Z, b.hi.Z-p.Z))
+	}
+	return max(b.sphere.distance(p), box)
+}
@@ -0,0 +1,219 @@
+package spt
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func boundsShapes() map[string]SDF3 {
+	return map[string]SDF3{
+		"Sphere":      Sphere(300),
+		"Cube":        Cube(25000, 25000, 10),
+		"Cylinder":    Cylinder(200, 50),
+		"CylinderR":   CylinderR(200, 100, 10),
+		"Capsule":     Capsule(750, 500, 250),
+		"Torus":       Torus(500, 350),
+		"Cone":        Cone(1000, 500),
+		"Pyramid":     Pyramid(1000, 1000),
+		"Ellipsoid":   Ellipsoid(100, 200, 300),
+		"Polygon":     Extrude(500, Polygon(5, 250)),
+		"Hexagram":    Extrude(100, Hexagram(100)),
+		"Bowl":        parabolicBowl(1000, 2000, 200),
+		"Revolve":     Revolve(300, Circle(100)),
+		"Elongate":    Elongate(500, 0, 0, Cylinder(1000, 500)),
+		"Repeat":      Repeat(1, 2, 0, 400, 400, 400, Sphere(200)),
+		"Hollow":      Hollow(20, Sphere(300)),
+		"Rotate":      RotateZ(30, RotateX(45, Cube(1000, 50, 50))),
+		"Scale":       Scale(2, TranslateX(100, Cube(50, 60, 70))),
+		"Distort":     Distort(V3(1, 0.4, 2), Sphere(100)),
+		"Mirror":      MirrorX(TranslateX(100, Sphere(50))),
+		"Gear":        GearWheel(),
+		"Difference":  Difference(Cube(800, 800, 800), Sphere(500)),
+		"Smooth":      SmoothUnion(100, Cube(800, 100, 100), TranslateY(300, Sphere(100))),
+		"Chamfer":     ChamferUnion(50, Cube(800, 100, 100), TranslateZ(100, Cylinder(100, 30))),
+		"Baked":       Bake(32, RotateY(20, Cube(800, 100, 100))),
+		"Polyhedron":  Polyhedron(boxMesh(V3(400, 10, 10))),
+		"Intersected": Intersection(Sphere(500), TranslateX(400, Sphere(500))),
+	}
+}
+
+func TestBounds(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for name, shape := range boundsShapes() {
+		if _, ok := shape.(Bounded); !ok {
+			t.Errorf("%s is not Bounded", name)
+			continue
+		}
+		lo, hi := Bounds(shape)
+		center, radius := shape.Sphere()
+		sdf := shape.SDF()
+		for i := 0; i < 20000; i++ {
+			p := center.Add(pickVec3(rnd).Scale(radius))
+			if sdf(p) < 0 && boxDistance2(p, lo, hi) > 1e-6 {
+				t.Errorf("%s at %v is outside bounds %v %v", name, p, lo, hi)
+				break
+			}
+		}
+	}
+}
+
+func TestBoundsTight(t *testing.T) {
+	// a thin slab gets a thin box, where its sphere is enormous
+	lo, hi := Bounds(Cube(25000, 25000, 10))
+	if hi.Z-lo.Z != 10 {
+		t.Errorf("slab bounds %v %v", lo, hi)
+	}
+
+	// a rotated rod stays a rod
+	lo, hi = Bounds(RotateZ(90, Cube(1000, 50, 50)))
+	if abs(hi.X-25) > 1e-6 || abs(hi.Y-500) > 1e-6 || abs(lo.Y+500) > 1e-6 {
+		t.Errorf("rotated rod bounds %v %v", lo, hi)
+	}
+
+	// union spheres follow the child boxes
+	_, radius := Union(
+		TranslateZ(-5, Cube(25000, 25000, 10)),
+		TranslateZ(5, Cube(25000, 25000, 10)),
+	).Sphere()
+	if radius > 25000 {
+		t.Errorf("union of slabs has radius %v", radius)
+	}
+
+	// negative factors flip the box, which must still be lo to hi
+	for name, shape := range map[string]SDF3{
+		"Scale":   Scale(-2, TranslateX(100, Cube(50, 60, 70))),
+		"Distort": Distort(V3(-1, 0.5, -2), TranslateX(100, Cube(50, 60, 70))),
+	} {
+		lo, hi := Bounds(shape)
+		if lo.X > hi.X || lo.Y > hi.Y || lo.Z > hi.Z {
+			t.Errorf("%s bounds %v %v", name, lo, hi)
+		}
+	}
+}
+
+// early-outs skip items without changing the distance, even inside the
+// items' boxes where the distance is negative
+func TestBoundsEarlyOut(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	a, b := Cube(800, 800, 800), TranslateX(300, Cube(400, 400, 400))
+	da, db := a.SDF(), b.SDF()
+	difference := Difference(a, b).SDF()
+	intersection := Intersection(a, b).SDF()
+	for i := 0; i < 20000; i++ {
+		p := pickVec3(rnd).Scale(1000)
+		if d, e := difference(p), max(da(p), -db(p)); abs(d-e) > 1e-9 {
+			t.Fatalf("difference at %v: %v, want %v", p, d, e)
+		}
+		if d, e := intersection(p), max(da(p), db(p)); d > e+1e-9 || (e < 0 && abs(d-e) > 1e-9) {
+			t.Fatalf("intersection at %v: %v, want %v", p, d, e)
+		}
+	}
+}
+
+func randomItems(rnd *rand.Rand, n int) []SDF3 {
+	var items []SDF3
+	for i := 0; i < n; i++ {
+		at := pickVec3(rnd).Scale(rnd.Float64() * 5000)
+		switch rnd.Intn(3) {
+		case 0:
+			items = append(items, Translate(at, Sphere(10+rnd.Float64()*2000)))
+		case 1:
+			items = append(items, Translate(at, Cube(10+rnd.Float64()*1000, 10+rnd.Float64()*1000, 10+rnd.Float64()*1000)))
+		default:
+			items = append(items, Translate(at, RotateX(rnd.Float64()*90, Cylinder(10+rnd.Float64()*1000, 10+rnd.Float64()*500))))
+		}
+	}
+	return items
+}
+
+func combinators(items []SDF3) map[string]SDF3 {
+	return map[string]SDF3{
+		"Union":               Union(items...),
+		"Difference":          Difference(items...),
+		"Intersection":        Intersection(items...),
+		"SmoothUnion":         SmoothUnion(50, items...),
+		"SmoothUnionExp":      SmoothUnionExp(50, items...),
+		"SmoothDifference":    SmoothDifference(50, items...),
+		"SmoothIntersection":  SmoothIntersection(50, items...),
+		"ChamferUnion":        ChamferUnion(50, items...),
+		"ChamferDifference":   ChamferDifference(50, items...),
+		"ChamferIntersection": ChamferIntersection(50, items...),
+		"StairsUnion":         StairsUnion(50, 4, items...),
+		"StairsDifference":    StairsDifference(50, 4, items...),
+		"StairsIntersection":  StairsIntersection(50, 4, items...),
+		"ColumnsUnion":        ColumnsUnion(50, 4, items...),
+		"ColumnsDifference":   ColumnsDifference(50, 4, items...),
+		"ColumnsIntersection": ColumnsIntersection(50, 4, items...),
+	}
+}
+
+// every item's sphere must sit inside its combinator's, at every level
+func checkEnclosed(t *testing.T, name string, sdf SDF3) {
+	v := reflect.ValueOf(sdf)
+	if v.Kind() != reflect.Struct || !v.FieldByName("Items").IsValid() {
+		return
+	}
+	items := v.FieldByName("Items").Interface().([]SDF3)
+	center, radius := sdf.Sphere()
+	for _, item := range items {
+		c, r := itemSphere(item)
+		if d := c.Sub(center).Length() + r; d > radius*(1+1e-9) {
+			t.Errorf("%s %T: item sphere %v %v escapes %v %v by %v", name, sdf, c, r, center, radius, d-radius)
+		}
+		checkEnclosed(t, name, item)
+	}
+}
+
+func TestBoundingSphereContains(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for n := 1; n <= 40; n++ {
+		items := randomItems(rnd, n)
+		for name, sdf := range combinators(items) {
+			checkEnclosed(t, name, sdf)
+		}
+	}
+
+	// nested trees
+	for i := 0; i < 20; i++ {
+		inner := []SDF3{
+			Union(randomItems(rnd, 5)...),
+			Intersection(randomItems(rnd, 3)...),
+			SmoothUnion(20, randomItems(rnd, 4)...),
+			TranslateX(3000, Union(randomItems(rnd, 3)...)),
+		}
+		for name, sdf := range combinators(inner) {
+			checkEnclosed(t, "nested "+name, sdf)
+		}
+		deep := Union(inner[0], SmoothUnion(10, inner[1], ChamferDifference(10, inner[2], inner[3])))
+		checkEnclosed(t, "deep", deep)
+	}
+}
+
+func TestBoundingSphereTight(t *testing.T) {
+	// two spheres side by side have an exact answer
+	center, radius := Union(TranslateX(-1000, Sphere(1000)), TranslateX(2000, Sphere(2000))).Sphere()
+	if abs(radius-3000) > 1e-6 || center.Sub(V3(1000, 0, 0)).Length() > 1e-6 {
+		t.Errorf("pair sphere %v %v", center, radius)
+	}
+
+	// a sphere inside another changes nothing
+	center, radius = Union(Sphere(1000), TranslateY(100, Sphere(10))).Sphere()
+	if abs(radius-1000) > 1e-6 || center.Length() > 1e-6 {
+		t.Errorf("nested sphere %v %v", center, radius)
+	}
+
+	// a ring of equal spheres is centered, and close to the optimum
+	var ring []SDF3
+	for i := 0; i < 12; i++ {
+		a := float64(i) / 12 * 2 * math.Pi
+		ring = append(ring, Translate(V3(math.Cos(a), math.Sin(a), 0).Scale(5000), Sphere(1)))
+	}
+	center, radius = Union(ring...).Sphere()
+	if radius > 5001*1.01 {
+		t.Errorf("ring sphere %v %v", center, radius)
+	}
+}
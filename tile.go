@@ -0,0 +1,286 @@
+package spt
+
+import (
+	"context"
+	"image"
+	"sync"
+	"time"
+)
+
+// A unit of work: some samples for a region of one pass.
+type Tile struct {
+	Pass    int
+	Region  image.Rectangle
+	Samples int      // per pixel, unless Budget is set
+	Budget  []uint16 // per pixel of Region, row by row, for adaptive passes
+	Taken   []uint32 // per pixel of Region, samples in earlier passes, for adaptive renders
+}
+
+// Renderers that can render part of a pass, returning a raster covering
+// only the tile's region. When row is set it's called with the rays
+// traced for each row as it finishes.
+type TileRenderer interface {
+	Renderer
+	RenderTile(ctx context.Context, scene Scene, tile Tile, row func(rays int)) (Raster, error)
+}
+
+const (
+	// default tile edge, in pixels
+	tileSize = 32
+	// passes that may be started while an older one is unfinished
+	tileLookahead = 1
+)
+
+// split a frame into tiles of at most size pixels square
+func tileRegions(width, height, size int) []image.Rectangle {
+	var regions []image.Rectangle
+	for y := 0; y < height; y += size {
+		for x := 0; x < width; x += size {
+			regions = append(regions, image.Rect(x, y, x+size, y+size).Intersect(image.Rect(0, 0, width, height)))
+		}
+	}
+	return regions
+}
+
+type tileWork struct {
+	tile    Tile
+	region  int // index in the scheduler's regions
+	done    bool
+	copies  []context.CancelFunc // every worker that took it
+	workers int                  // workers still rendering it
+	started time.Time
+}
+
+// Hands out tiles pass by pass. Workers that run out of fresh tiles steal
+// the oldest tile still in flight and race its owner for it, so a slow
+// worker never holds up the end of a pass for long.
+type tileScheduler struct {
+	sync.Mutex
+	cond     *sync.Cond
+	regions  []image.Rectangle
+	width    int
+	samples  int
+	passes   int              // last pass, or 0 for no limit
+	adaptive bool             // passes wait for the plan they follow
+	plans    map[int][]uint16 // adaptive plans, by the pass they were made after
+	taken    []uint32         // adaptive samples per pixel in passes before next
+	first    int              // first pass to render, after those resumed
+	next     int              // next pass to open
+	left     map[int]int
+	queue    []*tileWork
+	running  []*tileWork
+	stopped  bool
+}
+
+func newTileScheduler(scene Scene, size, first int) *tileScheduler {
+	if size <= 0 {
+		size = tileSize
+	}
+	s := &tileScheduler{
+		regions:  tileRegions(scene.Width, scene.Height, size),
+		width:    scene.Width,
+		samples:  scene.Samples,
+		passes:   scene.Passes,
+		adaptive: scene.Adaptive || scene.Noise > 0,
+		plans:    map[int][]uint16{},
+		first:    first,
+		next:     first,
+		left:     map[int]int{},
+	}
+	// Samplers number each pixel's samples on from its earlier passes',
+	// which adaptive passes give different numbers of samples. A resumed
+	// render's are in the raster it resumed with.
+	if s.adaptive {
+		s.taken = make([]uint32, scene.Width*scene.Height)
+		if first > 1 {
+			for i, p := range scene.Raster {
+				s.taken[i] = uint32(p.Rays)
+			}
+		}
+	}
+	s.cond = sync.NewCond(s)
+	return s
+}
+
+// oldest unfinished pass, or the next to open
+func (s *tileScheduler) oldest() int {
+	oldest := s.next
+	for pass := range s.left {
+		if pass < oldest {
+			oldest = pass
+		}
+	}
+	return oldest
+}
+
+func (s *tileScheduler) open() bool {
+	if s.passes > 0 && s.next > s.passes {
+		return false
+	}
+	if s.next > s.oldest()+tileLookahead {
+		return false
+	}
+	// Adaptive passes follow the plan made after the last pass that had
+	// to finish before they could open, whenever the others finish, so
+	// that a render repeats exactly. A resumed render's first passes
+	// follow the plan made from the raster it resumed with.
+	var budget []uint16
+	after := s.next - 1 - tileLookahead
+	if after < s.first-1 {
+		after = s.first - 1
+	}
+	if s.adaptive && after >= 1 {
+		var ok bool
+		if budget, ok = s.plans[after]; !ok {
+			return false
+		}
+		for pass := range s.plans {
+			if pass < after {
+				delete(s.plans, pass)
+			}
+		}
+	}
+	for i, region := range s.regions {
+		tile := Tile{Pass: s.next, Region: region, Samples: s.samples}
+		if budget != nil {
+			tile.Budget = make([]uint16, 0, region.Dx()*region.Dy())
+			for y := region.Min.Y; y < region.Max.Y; y++ {
+				row := y * s.width
+				tile.Budget = append(tile.Budget, budget[row+region.Min.X:row+region.Max.X]...)
+			}
+		}
+		if s.taken != nil {
+			tile.Taken = make([]uint32, 0, region.Dx()*region.Dy())
+			for y := region.Min.Y; y < region.Max.Y; y++ {
+				row := y * s.width
+				tile.Taken = append(tile.Taken, s.taken[row+region.Min.X:row+region.Max.X]...)
+			}
+		}
+		s.queue = append(s.queue, &tileWork{tile: tile, region: i})
+	}
+	for i := range s.taken {
+		if budget != nil {
+			s.taken[i] += uint32(budget[i])
+		} else {
+			s.taken[i] += uint32(s.samples)
+		}
+	}
+	s.left[s.next] = len(s.regions)
+	s.next++
+	return true
+}
+
+// Next tile for a worker, and a context cancelled if another worker
+// finishes it first. Blocks until there's work, or returns nil once
+// stopped or ctx is done.
+func (s *tileScheduler) take(ctx context.Context) (*tileWork, context.Context) {
+	s.Lock()
+	defer s.Unlock()
+
+	for !s.stopped && ctx.Err() == nil {
+		if len(s.queue) > 0 || s.open() {
+			work := s.queue[0]
+			s.queue = s.queue[1:]
+			work.started = time.Now()
+			s.running = append(s.running, work)
+			return work, s.copy(ctx, work)
+		}
+
+		// steal the longest running tile that only one worker has
+		var steal *tileWork
+		for _, work := range s.running {
+			if work.workers == 1 && (steal == nil || work.started.Before(steal.started)) {
+				steal = work
+			}
+		}
+		if steal != nil {
+			return steal, s.copy(ctx, steal)
+		}
+
+		s.cond.Wait()
+	}
+	return nil, nil
+}
+
+func (s *tileScheduler) copy(ctx context.Context, work *tileWork) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	work.copies = append(work.copies, cancel)
+	work.workers++
+	return ctx
+}
+
+// A worker finished a tile. Reports false when another worker beat it to
+// it, and the result should be dropped.
+func (s *tileScheduler) finish(work *tileWork) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if work.done {
+		return false
+	}
+	work.done = true
+	for _, cancel := range work.copies {
+		cancel()
+	}
+	s.remove(work)
+
+	pass := work.tile.Pass
+	if s.left[pass]--; s.left[pass] == 0 {
+		delete(s.left, pass)
+	}
+	s.cond.Broadcast()
+	return true
+}
+
+// A worker failed a tile, so queue it again unless another copy is still
+// going.
+func (s *tileScheduler) fail(work *tileWork) {
+	s.Lock()
+	defer s.Unlock()
+
+	if work.done {
+		return
+	}
+	work.workers--
+	if work.workers == 0 {
+		s.remove(work)
+		s.queue = append([]*tileWork{work}, s.queue...)
+	}
+	s.cond.Broadcast()
+}
+
+func (s *tileScheduler) remove(work *tileWork) {
+	for i, w := range s.running {
+		if w == work {
+			s.running = append(s.running[:i], s.running[i+1:]...)
+			return
+		}
+	}
+}
+
+// The adaptive plan made after merging a pass.
+func (s *tileScheduler) plan(pass int, budget []uint16) {
+	s.Lock()
+	defer s.Unlock()
+	s.plans[pass] = budget
+	s.cond.Broadcast()
+}
+
+// Wake workers waiting for tiles, so those whose context is done leave.
+func (s *tileScheduler) wake() {
+	s.Lock()
+	defer s.Unlock()
+	s.cond.Broadcast()
+}
+
+func (s *tileScheduler) stop() {
+	s.Lock()
+	defer s.Unlock()
+	s.stopped = true
+	for _, work := range s.running {
+		for _, cancel := range work.copies {
+			cancel()
+		}
+	}
+	s.cond.Broadcast()
+}
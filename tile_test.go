@@ -0,0 +1,235 @@
+package spt
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTileRegions(t *testing.T) {
+	covered := make([]int, 100*70)
+	for _, r := range tileRegions(100, 70, 32) {
+		if r.Dx() > 32 || r.Dy() > 32 || r.Empty() {
+			t.Errorf("tile %v", r)
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				covered[y*100+x]++
+			}
+		}
+	}
+	for i, n := range covered {
+		if n != 1 {
+			t.Fatalf("pixel %d covered %d times", i, n)
+		}
+	}
+}
+
+// a worker that hangs on every tile until cancelled
+type stalledRenderer struct{}
+
+func (r stalledRenderer) Render(scene Scene) (Raster, error) {
+	select {}
+}
+
+func (r stalledRenderer) RenderTile(ctx context.Context, scene Scene, tile Tile, row func(rays int)) (Raster, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// a worker that fails every tile
+type brokenRenderer struct{}
+
+func (r brokenRenderer) Render(scene Scene) (Raster, error) {
+	return nil, errors.New("broken")
+}
+
+// a renderer that knows nothing of tiles
+type frameRenderer struct{}
+
+func (r frameRenderer) Render(scene Scene) (Raster, error) {
+	return scene.Render(), nil
+}
+
+// a renderer of whole frames that can be cancelled
+type contextRenderer struct{}
+
+func (r contextRenderer) Render(scene Scene) (Raster, error) {
+	return scene.Render(), nil
+}
+
+func (r contextRenderer) RenderContext(ctx context.Context, scene Scene, row func(rays int)) (Raster, error) {
+	return scene.RenderContext(ctx, row)
+}
+
+// every pixel got exactly the samples asked for, so no tile was merged
+// twice or lost
+func checkPasses(t *testing.T, name string, scene Scene, renderers []Renderer) {
+	scene.Passes = 3
+	var last *Scene
+	for frame := range RenderContext(context.Background(), scene, renderers, RenderOptions{
+		TileSize: 8,
+		Deadline: time.Now().Add(30 * time.Second),
+	}) {
+		last = frame.(*Scene)
+	}
+	if last == nil {
+		t.Fatalf("%s: no frames", name)
+	}
+	for i, p := range last.Raster {
+		if want := int32(scene.Passes * scene.Samples); p.Rays != want {
+			t.Fatalf("%s: pixel %d has %d rays, want %d", name, i, p.Rays, want)
+		}
+	}
+}
+
+func TestTileStealing(t *testing.T) {
+	scene := tinyScene()
+
+	start := time.Now()
+	checkPasses(t, "stalled", scene, []Renderer{stalledRenderer{}, NewLocalRenderer()})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("stalled worker held up the render for %v", elapsed)
+	}
+
+	checkPasses(t, "broken", scene, []Renderer{brokenRenderer{}, NewLocalRenderer()})
+	checkPasses(t, "frame", scene, []Renderer{frameRenderer{}, frameRenderer{}})
+	checkPasses(t, "context", scene, []Renderer{contextRenderer{}, frameRenderer{}})
+
+	// more samples than a budget holds are turned away, not wrapped
+	tile := Tile{Pass: 1, Region: image.Rect(0, 0, 8, 8), Samples: MaxSamples + 1}
+	if _, err := renderTile(context.Background(), frameRenderer{}, scene, tile, nil); err == nil {
+		t.Errorf("rendered %d samples per pixel", tile.Samples)
+	}
+}
+
+// adaptive tiles say how many samples each pixel took in earlier passes,
+// for samplers to carry on from
+func TestTileTaken(t *testing.T) {
+	scene := tinyScene()
+	scene.Width, scene.Height = 4, 2
+	scene.Samples, scene.Adaptive = 2, true
+	s := newTileScheduler(scene, 2, 1)
+	budget := []uint16{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// the first row of each pass's tiles, taken and finished in turn
+	taken := map[int][]uint32{}
+	for i := 0; i < 8; i++ {
+		switch i {
+		case 4:
+			s.plan(1, budget)
+		case 6:
+			s.plan(2, budget)
+		}
+		work, _ := s.take(context.Background())
+		s.finish(work)
+		taken[work.tile.Pass] = append(taken[work.tile.Pass], work.tile.Taken[:2]...)
+	}
+	for pass, want := range map[int][]uint32{1: {0, 0, 0, 0}, 2: {2, 2, 2, 2}, 3: {4, 4, 4, 4}, 4: {5, 6, 7, 8}} {
+		if got := taken[pass]; !reflect.DeepEqual(got, want) {
+			t.Errorf("pass %d took %v before, want %v", pass, got, want)
+		}
+	}
+}
+
+func TestRPCTile(t *testing.T) {
+	scene := tinyScene()
+	tile := Tile{Pass: 2, Region: image.Rect(8, 4, 20, 9), Samples: 3}
+
+	var cr CompressedRaster
+	if err := (RenderRPC{}).RenderTile(TileJob{scene, tile}, &cr); err != nil {
+		t.Fatal(err)
+	}
+	raster := make(Raster, tile.Region.Dx()*tile.Region.Dy())
+	fr := flate.NewReader(bytes.NewReader(cr.Buf))
+	if err := binary.Read(fr, binary.LittleEndian, raster); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := fr.Read(make([]byte, 1)); n != 0 {
+		t.Errorf("tile raster is larger than its region")
+	}
+	for i, p := range raster {
+		if p.Rays != 3 {
+			t.Fatalf("pixel %d has %d rays", i, p.Rays)
+		}
+	}
+}
+
+func renderFrames(t *testing.T, scene Scene, renderers []Renderer) []*Scene {
+	var frames []*Scene
+	for frame := range RenderContext(context.Background(), scene, renderers, RenderOptions{
+		TileSize: 8,
+		Deadline: time.Now().Add(30 * time.Second),
+	}) {
+		frames = append(frames, frame.(*Scene))
+	}
+	if len(frames) != scene.Passes {
+		t.Fatalf("%d frames of %d", len(frames), scene.Passes)
+	}
+	return frames
+}
+
+// a render with a given seed is the same, bit for bit, however many
+// workers took part and however they rendered
+func TestReproducible(t *testing.T) {
+	addr, _, stop := testWorker(t, newSceneCache(sceneCacheSize))
+	defer stop()
+	remote := NewRPCRenderer(addr)
+	defer remote.(RPCRenderer).Close()
+
+	plain := tinyScene()
+	plain.Passes, plain.Samples = 3, 2
+	plain.Seed = 42
+	filtered := plain
+	filtered.Filter, filtered.Sampler = Mitchell{}, Sobol{}
+	filtered.AOV = true
+	adaptive := plain
+	adaptive.Passes, adaptive.Samples = 4, 4
+	adaptive.Filter, adaptive.Adaptive = Gaussian{}, true
+	adaptive.Sampler = Stratified{}
+
+	for name, scene := range map[string]Scene{"plain": plain, "filtered": filtered, "adaptive": adaptive} {
+		one := renderFrames(t, scene, []Renderer{NewLocalRenderer()})
+		three := renderFrames(t, scene, []Renderer{NewLocalRenderer(), remote, frameRenderer{}})
+		for pass := range one {
+			for i := range one[pass].Raster {
+				if a, b := one[pass].Raster[i], three[pass].Raster[i]; a != b {
+					t.Fatalf("%s: pass %d pixel %d: %+v with one worker, %+v with three", name, pass+1, i, a, b)
+				}
+			}
+		}
+	}
+
+	// passes differ, whichever worker rendered them
+	frames := renderFrames(t, plain, []Renderer{remote})
+	same := true
+	for i, p := range frames[1].Raster {
+		if p.Color != frames[0].Raster[i].Color.Scale(2) {
+			same = false
+		}
+	}
+	if same {
+		t.Error("every pass the same")
+	}
+
+	// without a seed, the frames say which was used
+	plain.Seed = 0
+	plain.Passes = 1
+	first := renderFrames(t, plain, nil)[0]
+	if first.Seed == 0 {
+		t.Fatal("no seed in the frames")
+	}
+	plain.Seed = first.Seed
+	again := renderFrames(t, plain, []Renderer{remote})[0]
+	for i := range first.Raster {
+		if first.Raster[i] != again.Raster[i] {
+			t.Fatalf("pixel %d: %+v, then %+v with seed %d", i, first.Raster[i], again.Raster[i], first.Seed)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package spt
+
+import (
+	"encoding/gob"
+	"image"
+	"image/color"
+	"math"
+)
+
+func init() {
+	gob.Register(Clip{})
+	gob.Register(Reinhard{})
+	gob.Register(ACES{})
+	gob.Register(Hable{})
+}
+
+// How linear radiance becomes display color: exposure, white balance, a
+// tone map for the highlights, and a transfer curve. The zero value clips
+// highlights and uses the sRGB curve.
+type Display struct {
+	Exposure float64 // in stops, so 1 doubles the brightness
+	Balance  Color   // multiplier per channel, zero for none
+	Tone     ToneMap // Optional, clips when nil
+	Gamma    float64 // power curve 1/Gamma instead of sRGB when set
+}
+
+// Compresses exposed, white balanced radiance into 0..1.
+type ToneMap interface {
+	Map(Color) Color
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// Hard clipping, as before tone mapping.
+type Clip struct{}
+
+func (t Clip) Map(c Color) Color {
+	return Color{clamp01(c.R), clamp01(c.G), clamp01(c.B)}
+}
+
+// Reinhard's operator on luminance, keeping hue. White is the luminance
+// that maps to 1; zero approaches 1 only at infinity.
+type Reinhard struct {
+	White float64
+}
+
+func (t Reinhard) Map(c Color) Color {
+	l := c.Brightness()
+	if l <= 0 {
+		return Naught
+	}
+	m := l / (1 + l)
+	if t.White > 0 {
+		m = l * (1 + l/(t.White*t.White)) / (1 + l)
+	}
+	return Clip{}.Map(c.Scale(m / l))
+}
+
+// Narkowicz's fit of the ACES filmic curve, per channel.
+type ACES struct{}
+
+func (t ACES) Map(c Color) Color {
+	f := func(x float64) float64 {
+		return clamp01(x * (2.51*x + 0.03) / (x*(2.43*x+0.59) + 0.14))
+	}
+	return Color{f(c.R), f(c.G), f(c.B)}
+}
+
+// Hable's Uncharted 2 filmic curve, per channel. The curve doubles its
+// input, so linear values of half White map to 1; White is 11.2 when
+// zero.
+type Hable struct {
+	White float64
+}
+
+func hable(x float64) float64 {
+	const a, b, c, d, e, f = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+func (t Hable) Map(c Color) Color {
+	white := t.White
+	if white <= 0 {
+		white = 11.2
+	}
+	scale := 1 / hable(white)
+	// the curve expects twice the exposure
+	f := func(x float64) float64 {
+		return clamp01(hable(2*x) * scale)
+	}
+	return Color{f(c.R), f(c.G), f(c.B)}
+}
+
+// The sRGB transfer function, for a linear value in 0..1.
+func SRGB(v float64) float64 {
+	switch {
+	case v <= 0.0031308:
+		return 12.92 * v
+	case v >= 1:
+		return 1 // exactly, not 1.055 - 0.055
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Linear radiance to display color in 0..1.
+func (d Display) Apply(c Color) Color {
+	if d.Exposure != 0 {
+		c = c.Scale(math.Exp2(d.Exposure))
+	}
+	if d.Balance != Naught {
+		c = c.Mul(d.Balance)
+	}
+	if d.Tone != nil {
+		c = d.Tone.Map(c)
+	}
+	c = Clip{}.Map(c)
+	if d.Gamma > 0 {
+		return Color{math.Pow(c.R, 1/d.Gamma), math.Pow(c.G, 1/d.Gamma), math.Pow(c.B, 1/d.Gamma)}
+	}
+	return Color{SRGB(c.R), SRGB(c.G), SRGB(c.B)}
+}
+
+// An image's linear pixels through a display transform, for saving
+// with a different look than the scene's own.
+func (d Display) Image(img LinearImage) image.Image {
+	return displayImage{img, d}
+}
+
+type displayImage struct {
+	LinearImage
+	display Display
+}
+
+func (i displayImage) ColorModel() color.Model {
+	return color.NRGBAModel
+}
+
+func (i displayImage) At(x, y int) color.Color {
+	c, alpha := i.Linear(x, y)
+	if c == Naught {
+		return Transparent
+	}
+	return displayColor(i.display.Apply(c), alpha)
+}
+
+// a display color with alpha, as 8-bit NRGBA
+func displayColor(c Color, alpha float64) color.Color {
+	if alpha < 1 {
+		u := func(v float64) uint8 {
+			return uint8(255.0 * v)
+		}
+		return color.NRGBA{u(c.R), u(c.G), u(c.B), u(alpha)}
+	}
+	return c
+}
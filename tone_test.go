@@ -0,0 +1,87 @@
+package spt
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestToneMaps(t *testing.T) {
+	for _, tone := range []ToneMap{Clip{}, Reinhard{}, Reinhard{4}, ACES{}, Hable{}} {
+		last := -1.0
+		for v := 0.0; v < 64; v += 0.125 {
+			c := tone.Map(White.Scale(v))
+			if c.R != c.G || c.G != c.B {
+				t.Fatalf("%T: grey %v became %v", tone, v, c)
+			}
+			if c.R < 0 || c.R > 1 || c.R < last {
+				t.Fatalf("%T: %v became %v after %v", tone, v, c.R, last)
+			}
+			last = c.R
+		}
+		if c := tone.Map(Naught); c != Naught {
+			t.Errorf("%T: black became %v", tone, c)
+		}
+	}
+
+	for _, c := range []struct {
+		tone ToneMap
+		in   Color
+		want float64
+	}{
+		{Clip{}, White.Scale(4), 1},
+		{Reinhard{}, White, 0.5},
+		{Reinhard{4}, White.Scale(4), 1},
+		{ACES{}, White, 0.8037974683544303},
+		{Hable{}, White.Scale(5.6), 1},
+	} {
+		if got := c.tone.Map(c.in); math.Abs(got.R-c.want) > 1e-9 {
+			t.Errorf("%T%v: %v became %v, want %v", c.tone, c.tone, c.in, got.R, c.want)
+		}
+	}
+
+	// Reinhard keeps hue
+	if c := (Reinhard{}).Map(Color{2, 1, 0}); math.Abs(c.R-2*c.G) > 1e-9 || c.B != 0 {
+		t.Errorf("hue shifted: %v", c)
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	for _, c := range []struct {
+		v, want float64
+	}{
+		{0, 0}, {0.001, 0.01292}, {0.5, 0.7353569830524495}, {1, 1}, {4, 1},
+	} {
+		if got := (Display{}).Apply(White.Scale(c.v)); math.Abs(got.R-c.want) > 1e-9 {
+			t.Errorf("srgb %v: %v, want %v", c.v, got.R, c.want)
+		}
+	}
+
+	d := Display{Exposure: -1, Balance: Color{1, 0.5, 0.25}, Gamma: 2}
+	if got := d.Apply(White); math.Abs(got.R-math.Sqrt(0.5)) > 1e-9 || math.Abs(got.G-0.5) > 1e-9 || math.Abs(got.B-math.Sqrt(0.125)) > 1e-9 {
+		t.Errorf("exposure and balance: %v", got)
+	}
+
+	// a light four times white blows out unless tone mapped
+	scene := hdrScene(4, 3)
+	scene.Raster[3] = Pixel{Color: White.Scale(16), Rays: 4, Alpha: 4}
+	if c := color.NRGBAModel.Convert(scene.At(3, 0)).(color.NRGBA); c.R != 255 || c.G != 255 {
+		t.Errorf("clipped %v", c)
+	}
+	scene.Display.Tone = ACES{}
+	if c := color.NRGBAModel.Convert(scene.At(3, 0)).(color.NRGBA); c.R == 255 || c.R < 240 {
+		t.Errorf("aces %v", c)
+	}
+
+	// or the same scene through another display at save time
+	img := Display{Exposure: -2}.Image(scene)
+	if c := color.NRGBAModel.Convert(img.At(3, 0)).(color.NRGBA); c.R != 255 {
+		t.Errorf("exposure -2 of 4 %v", c)
+	}
+	if c := color.NRGBAModel.Convert(img.At(2, 1)).(color.NRGBA); c.A != 63 {
+		t.Errorf("shadow alpha lost %v", c)
+	}
+	if _, ok := img.(LinearImage); !ok {
+		t.Error("display image lost its linear pixels")
+	}
+}
@@ -13,6 +13,18 @@ func init() {
 	gob.Register(SDFUnion{})
 	gob.Register(SDFDifference{})
 	gob.Register(SDFIntersection{})
+	gob.Register(SDFSmoothUnion{})
+	gob.Register(SDFSmoothDifference{})
+	gob.Register(SDFSmoothIntersection{})
+	gob.Register(SDFChamferUnion{})
+	gob.Register(SDFChamferDifference{})
+	gob.Register(SDFChamferIntersection{})
+	gob.Register(SDFStairsUnion{})
+	gob.Register(SDFStairsDifference{})
+	gob.Register(SDFStairsIntersection{})
+	gob.Register(SDFColumnsUnion{})
+	gob.Register(SDFColumnsDifference{})
+	gob.Register(SDFColumnsIntersection{})
 }
 
 type Matrix44 struct {
@@ -29,6 +41,28 @@ func (a Matrix44) MulVec3(b Vec3) Vec3 {
 	return Vec3{x, y, z}
 }
 
+// Transform a box, returning the box around the result.
+func (a Matrix44) MulBox(lo, hi Vec3) (Vec3, Vec3) {
+	// Arvo, Transforming Axis-Aligned Bounding Boxes, Graphics Gems 1990
+	rows := [3][4]float64{
+		{a.X00, a.X01, a.X02, a.X03},
+		{a.X10, a.X11, a.X12, a.X13},
+		{a.X20, a.X21, a.X22, a.X23},
+	}
+	l := [3]float64{lo.X, lo.Y, lo.Z}
+	h := [3]float64{hi.X, hi.Y, hi.Z}
+	var nlo, nhi [3]float64
+	for i := 0; i < 3; i++ {
+		nlo[i], nhi[i] = rows[i][3], rows[i][3]
+		for j := 0; j < 3; j++ {
+			e, f := rows[i][j]*l[j], rows[i][j]*h[j]
+			nlo[i] += math.Min(e, f)
+			nhi[i] += math.Max(e, f)
+		}
+	}
+	return V3(nlo[0], nlo[1], nlo[2]), V3(nhi[0], nhi[1], nhi[2])
+}
+
 func (a Matrix44) Determinant() float64 {
 	return (a.X00*a.X11*a.X22*a.X33 - a.X00*a.X11*a.X23*a.X32 +
 		a.X00*a.X12*a.X23*a.X31 - a.X00*a.X12*a.X21*a.X33 +
@@ -114,6 +148,11 @@ func (s SDFTransform) Sphere() (Vec3, float64) {
 	return s.M.MulVec3(center), radius
 }
 
+func (s SDFTransform) Bounds() (Vec3, Vec3) {
+	lo, hi := Bounds(s.SDF3)
+	return s.M.MulBox(lo, hi)
+}
+
 func Translate(v Vec3, sdf SDF3) SDF3 {
 	m := Translation(v)
 	return SDFTransform{sdf, m, m.Inverse()}
@@ -165,6 +204,12 @@ func (s SDFScale) Sphere() (Vec3, float64) {
 	return center, radius * s.Factor
 }
 
+func (s SDFScale) Bounds() (Vec3, Vec3) {
+	lo, hi := Bounds(s.SDF3)
+	lo, hi = lo.Scale(s.Factor), hi.Scale(s.Factor)
+	return min3(lo, hi), max3(lo, hi)
+}
+
 func Scale(factor float64, sdf SDF3) SDF3 {
 	return SDFScale{sdf, factor}
 }
@@ -187,6 +232,12 @@ func (s SDFDistort) Sphere() (Vec3, float64) {
 	return center, radius * max(max(s.Factor.X, s.Factor.Y), s.Factor.Z)
 }
 
+func (s SDFDistort) Bounds() (Vec3, Vec3) {
+	lo, hi := Bounds(s.SDF3)
+	lo, hi = lo.Mul(s.Factor), hi.Mul(s.Factor)
+	return min3(lo, hi), max3(lo, hi)
+}
+
 func Distort(factor Vec3, sdf SDF3) SDF3 {
 	return SDFDistort{sdf, factor}
 }
@@ -208,6 +259,12 @@ func (s SDFMirror) Sphere() (Vec3, float64) {
 	return center.Mul(s.Mul), radius
 }
 
+func (s SDFMirror) Bounds() (Vec3, Vec3) {
+	lo, hi := Bounds(s.SDF3)
+	lo, hi = lo.Mul(s.Mul), hi.Mul(s.Mul)
+	return min3(lo, hi), max3(lo, hi)
+}
+
 func Mirror(mul Vec3, sdf SDF3) SDF3 {
 	return SDFMirror{sdf, mul}
 }
@@ -224,40 +281,15 @@ func MirrorZ(sdf SDF3) SDF3 {
 	return Mirror(V3(1, 1, -1), sdf)
 }
 
-func itemsBoundingSphere(items []SDF3) (Vec3, float64) {
-	centers := Zero3
-	mradius := 0.0
-	points := []Vec3{}
+// The SDFs of a combinator's items, and their bounds for early-outs.
+func itemsSDF(items []SDF3) ([]func(Vec3) float64, []bound) {
+	var sdfs []func(Vec3) float64
+	var bounds []bound
 	for _, item := range items {
-		center, radius := item.Sphere()
-		mradius = max(mradius, radius)
-		centers = centers.Add(center)
-		points = append(points, center.Add(Vec3{radius, 0, 0}))
-		points = append(points, center.Add(Vec3{-radius, 0, 0}))
-		points = append(points, center.Add(Vec3{0, radius, 0}))
-		points = append(points, center.Add(Vec3{0, -radius, 0}))
-		points = append(points, center.Add(Vec3{0, 0, radius}))
-		points = append(points, center.Add(Vec3{0, 0, -radius}))
-	}
-
-	center := centers.Scale(1.0 / float64(len(items)))
-	radius := mradius
-
-	for {
-		encompass := true
-		for _, p := range points {
-			d := len3(sub3(p, center)) - radius
-			if d > 0 {
-				encompass = false
-				radius += 1.0
-			}
-		}
-		if encompass {
-			break
-		}
+		sdfs = append(sdfs, item.SDF())
+		bounds = append(bounds, itemBound(item))
 	}
-
-	return center, radius
+	return sdfs, bounds
 }
 
 type SDFUnion struct {
@@ -265,18 +297,12 @@ type SDFUnion struct {
 }
 
 func (s SDFUnion) SDF() func(Vec3) float64 {
-	var items []func(Vec3) float64
-	var spheres []sphere
-	for _, item := range s.Items {
-		items = append(items, item.SDF())
-		c, r := item.Sphere()
-		spheres = append(spheres, sphere{c, r})
-	}
+	items, bounds := itemsSDF(s.Items)
 	return func(pos Vec3) float64 {
 		var dist float64
 		for i, sdf := range items {
 			if i > 0 {
-				bd := spheres[i].distance(pos)
+				bd := bounds[i].distance(pos)
 				if bd > dist {
 					continue
 				}
@@ -295,6 +321,10 @@ func (s SDFUnion) Sphere() (Vec3, float64) {
 	return center, radius
 }
 
+func (s SDFUnion) Bounds() (Vec3, Vec3) {
+	return itemsBoundsUnion(s.Items)
+}
+
 func Union(items ...SDF3) SDF3 {
 	return SDFUnion{items}
 }
@@ -304,18 +334,12 @@ type SDFDifference struct {
 }
 
 func (s SDFDifference) SDF() func(Vec3) float64 {
-	var items []func(Vec3) float64
-	var spheres []sphere
-	for _, item := range s.Items {
-		items = append(items, item.SDF())
-		c, r := item.Sphere()
-		spheres = append(spheres, sphere{c, r})
-	}
+	items, bounds := itemsSDF(s.Items)
 	return func(pos Vec3) float64 {
 		var dist float64
 		for i, sdf := range items {
 			if i > 0 {
-				bd := spheres[i].distance(pos)
+				bd := bounds[i].distance(pos)
 				if -bd < dist {
 					continue
 				}
@@ -336,6 +360,10 @@ func (s SDFDifference) Sphere() (Vec3, float64) {
 	return center, radius
 }
 
+func (s SDFDifference) Bounds() (Vec3, Vec3) {
+	return Bounds(s.Items[0])
+}
+
 func Difference(items ...SDF3) SDF3 {
 	return SDFDifference{items}
 }
@@ -345,19 +373,16 @@ type SDFIntersection struct {
 }
 
 func (s SDFIntersection) SDF() func(Vec3) float64 {
-	var items []func(Vec3) float64
-	var spheres []sphere
-	for _, item := range s.Items {
-		items = append(items, item.SDF())
-		c, r := item.Sphere()
-		spheres = append(spheres, sphere{c, r})
-	}
+	items, bounds := itemsSDF(s.Items)
 	return func(pos Vec3) float64 {
 		var dist float64
 		for i, sdf := range items {
 			if i > 0 {
-				bd := spheres[i].distance(pos)
+				// outside an item's bounds its distance is at least the
+				// bounds distance, which is a safe stand-in for it
+				bd := bounds[i].distance(pos)
 				if bd > dist {
+					dist = bd
 					continue
 				}
 			}
@@ -375,6 +400,635 @@ func (s SDFIntersection) Sphere() (Vec3, float64) {
 	return center, radius
 }
 
+func (s SDFIntersection) Bounds() (Vec3, Vec3) {
+	return itemsBoundsIntersection(s.Items)
+}
+
 func Intersection(items ...SDF3) SDF3 {
 	return SDFIntersection{items}
 }
+
+// polynomial smooth min; k is the blend radius, and none blends nothing
+func sminPoly(a, b, k float64) float64 {
+	if k <= 0 {
+		return min(a, b)
+	}
+	h := max(k-abs(a-b), 0.0) / k
+	return min(a, b) - h*h*k*0.25
+}
+
+// polynomial smooth max; k is the blend radius
+func smaxPoly(a, b, k float64) float64 {
+	return -sminPoly(-a, -b, k)
+}
+
+// exponential smooth min; k is the blend radius. Unlike the polynomial
+// version this is associative, so blending several items in sequence
+// gives the same result regardless of order
+func sminExp(a, b, k float64) float64 {
+	m := min(a, b)
+	if k <= 0 {
+		return m
+	}
+	return m - k*math.Log(math.Exp((m-a)/k)+math.Exp((m-b)/k))
+}
+
+// exponential smooth max; k is the blend radius
+func smaxExp(a, b, k float64) float64 {
+	return -sminExp(-a, -b, k)
+}
+
+// beyond this many blend radii an exponential blend contributes less
+// than 1e-7 of k, so items that far away can be skipped
+const smoothExpReach = 16.0
+
+type SDFSmoothUnion struct {
+	Items []SDF3
+	K     float64
+	Exp   bool
+}
+
+func (s SDFSmoothUnion) SDF() func(Vec3) float64 {
+	items, bounds := itemsSDF(s.Items)
+	k := math.Max(0, s.K)
+	smin := sminPoly
+	reach := k
+	if s.Exp {
+		smin = sminExp
+		reach = k * smoothExpReach
+	}
+	return func(pos Vec3) float64 {
+		var dist float64
+		for i, sdf := range items {
+			if i > 0 {
+				bd := bounds[i].distance(pos)
+				if bd > dist+reach {
+					continue
+				}
+			}
+			d := sdf(pos)
+			if i == 0 {
+				dist = d
+			} else {
+				dist = smin(dist, d, k)
+			}
+		}
+		return dist
+	}
+}
+
+func (s SDFSmoothUnion) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius + s.grow()
+}
+
+func (s SDFSmoothUnion) Bounds() (Vec3, Vec3) {
+	lo, hi := itemsBoundsUnion(s.Items)
+	return boxGrow(lo, hi, s.grow())
+}
+
+// blending pulls the surface outward. The polynomial variant blends in
+// pairs, each pulling at most k/4 more, so k/4 per item after the first;
+// the exponential variant blends all at once, at most k*ln(n).
+func (s SDFSmoothUnion) grow() float64 {
+	k := math.Max(0, s.K)
+	n := float64(len(s.Items))
+	if s.Exp {
+		return k * math.Log(n)
+	}
+	return k * 0.25 * math.Max(0, n-1)
+}
+
+// union with seams filleted over blend radius k, a plain union when k is
+// 0 or less
+func SmoothUnion(k float64, items ...SDF3) SDF3 {
+	return SDFSmoothUnion{items, k, false}
+}
+
+// exponential variant of SmoothUnion; softer and order independent
+func SmoothUnionExp(k float64, items ...SDF3) SDF3 {
+	return SDFSmoothUnion{items, k, true}
+}
+
+type SDFSmoothDifference struct {
+	Items []SDF3
+	K     float64
+	Exp   bool
+}
+
+func (s SDFSmoothDifference) SDF() func(Vec3) float64 {
+	items, bounds := itemsSDF(s.Items)
+	k := math.Max(0, s.K)
+	smax := smaxPoly
+	reach := k
+	if s.Exp {
+		smax = smaxExp
+		reach = k * smoothExpReach
+	}
+	return func(pos Vec3) float64 {
+		var dist float64
+		for i, sdf := range items {
+			if i > 0 {
+				bd := bounds[i].distance(pos)
+				if -bd < dist-reach {
+					continue
+				}
+			}
+			d := sdf(pos)
+			if i == 0 {
+				dist = d
+			} else {
+				dist = smax(dist, -d, k)
+			}
+		}
+		return dist
+	}
+}
+
+func (s SDFSmoothDifference) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius
+}
+
+func (s SDFSmoothDifference) Bounds() (Vec3, Vec3) {
+	return Bounds(s.Items[0])
+}
+
+// difference with cut edges filleted over blend radius k
+func SmoothDifference(k float64, items ...SDF3) SDF3 {
+	return SDFSmoothDifference{items, k, false}
+}
+
+// exponential variant of SmoothDifference
+func SmoothDifferenceExp(k float64, items ...SDF3) SDF3 {
+	return SDFSmoothDifference{items, k, true}
+}
+
+type SDFSmoothIntersection struct {
+	Items []SDF3
+	K     float64
+	Exp   bool
+}
+
+func (s SDFSmoothIntersection) SDF() func(Vec3) float64 {
+	items, bounds := itemsSDF(s.Items)
+	k := math.Max(0, s.K)
+	smax := smaxPoly
+	if s.Exp {
+		smax = smaxExp
+	}
+	return func(pos Vec3) float64 {
+		var dist float64
+		for i, sdf := range items {
+			if i > 0 {
+				// outside an item's bounding sphere its distance is at least
+				// the sphere distance, and blending with that lower bound
+				// still gives a conservative result for marching
+				bd := bounds[i].distance(pos)
+				if bd > dist {
+					dist = smax(dist, bd, k)
+					continue
+				}
+			}
+			d := sdf(pos)
+			if i == 0 {
+				dist = d
+			} else {
+				dist = smax(dist, d, k)
+			}
+		}
+		return dist
+	}
+}
+
+func (s SDFSmoothIntersection) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius
+}
+
+func (s SDFSmoothIntersection) Bounds() (Vec3, Vec3) {
+	return itemsBoundsIntersection(s.Items)
+}
+
+// intersection with edges rounded over blend radius k
+func SmoothIntersection(k float64, items ...SDF3) SDF3 {
+	return SDFSmoothIntersection{items, k, false}
+}
+
+// exponential variant of SmoothIntersection
+func SmoothIntersectionExp(k float64, items ...SDF3) SDF3 {
+	return SDFSmoothIntersection{items, k, true}
+}
+
+// Fold items with a union-like blend. The blend must equal min(a, b)
+// whenever b > max(a, 0) + reach, which lets items whose bounding
+// sphere is that far away be skipped.
+func blendUnion(items []SDF3, reach float64, blend func(a, b float64) float64) func(Vec3) float64 {
+	sdfs, bounds := itemsSDF(items)
+	return func(pos Vec3) float64 {
+		var dist float64
+		for i, sdf := range sdfs {
+			if i > 0 {
+				bd := bounds[i].distance(pos)
+				if bd > max(dist, 0)+reach {
+					continue
+				}
+			}
+			d := sdf(pos)
+			if i == 0 {
+				dist = d
+			} else {
+				dist = blend(dist, d)
+			}
+		}
+		return dist
+	}
+}
+
+// Fold items with a difference-like blend. The blend must equal a
+// whenever b > max(-a, 0) + reach.
+func blendDifference(items []SDF3, reach float64, blend func(a, b float64) float64) func(Vec3) float64 {
+	sdfs, bounds := itemsSDF(items)
+	return func(pos Vec3) float64 {
+		var dist float64
+		for i, sdf := range sdfs {
+			if i > 0 {
+				bd := bounds[i].distance(pos)
+				if bd > max(-dist, 0)+reach {
+					continue
+				}
+			}
+			d := sdf(pos)
+			if i == 0 {
+				dist = d
+			} else {
+				dist = blend(dist, d)
+			}
+		}
+		return dist
+	}
+}
+
+// Fold items with an intersection-like blend. Bounding spheres don't
+// help here as the farthest item dominates, so every item is evaluated.
+func blendIntersection(items []SDF3, blend func(a, b float64) float64) func(Vec3) float64 {
+	sdfs, _ := itemsSDF(items)
+	return func(pos Vec3) float64 {
+		var dist float64
+		for i, sdf := range sdfs {
+			d := sdf(pos)
+			if i == 0 {
+				dist = d
+			} else {
+				dist = blend(dist, d)
+			}
+		}
+		return dist
+	}
+}
+
+// http://mercury.sexy/hg_sdf/
+
+func chamferUnion(a, b, r float64) float64 {
+	return min(min(a, b), (a-r+b)*math.Sqrt(0.5))
+}
+
+func chamferIntersection(a, b, r float64) float64 {
+	return max(max(a, b), (a+r+b)*math.Sqrt(0.5))
+}
+
+func chamferDifference(a, b, r float64) float64 {
+	return chamferIntersection(a, -b, r)
+}
+
+// Stairs and columns need at least one step, and a size to divide among
+// them; without one they're the plain operation.
+func steps(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+func stairsUnion(a, b, r float64, n int) float64 {
+	if r <= 0 {
+		return min(a, b)
+	}
+	s := r / float64(steps(n))
+	u := b - r
+	return min(min(a, b), 0.5*(u+a+abs(mod1(u-a+s, 2*s)-s)))
+}
+
+func stairsIntersection(a, b, r float64, n int) float64 {
+	return -stairsUnion(-a, -b, r, n)
+}
+
+func stairsDifference(a, b, r float64, n int) float64 {
+	return -stairsUnion(-a, b, r, n)
+}
+
+func columnsUnion(a, b, r float64, n int) float64 {
+	n = steps(n)
+	if a < r && b < r && r > 0 {
+		p := V2(a, b)
+		cr := r * math.Sqrt2 / (float64(n-1)*2 + math.Sqrt2)
+		p = rotate45(p)
+		p.X -= math.Sqrt2 / 2 * r
+		p.X += cr * math.Sqrt2
+		if n%2 == 1 {
+			p.Y += cr
+		}
+		// turned 45 degrees and moved onto the diagonal, now repeat
+		// along it and place a circle
+		p.Y = repeat1(p.Y, cr*2)
+		d := len2(p) - cr
+		d = min(d, p.X)
+		d = min(d, a)
+		return min(d, b)
+	}
+	return min(a, b)
+}
+
+func columnsDifference(a, b, r float64, n int) float64 {
+	a = -a
+	m := min(a, b)
+	n = steps(n)
+	if a < r && b < r && r > 0 {
+		p := V2(a, b)
+		cr := r * math.Sqrt2 / (float64(n-1)*2 + math.Sqrt2)
+		p = rotate45(p)
+		p.Y += cr
+		p.X -= math.Sqrt2 / 2 * r
+		p.X += -cr * math.Sqrt2 / 2
+		if n%2 == 1 {
+			p.Y += cr
+		}
+		p.Y = repeat1(p.Y, cr*2)
+		d := -len2(p) + cr
+		d = max(d, p.X)
+		d = min(d, a)
+		return -min(d, b)
+	}
+	return -m
+}
+
+func columnsIntersection(a, b, r float64, n int) float64 {
+	return columnsDifference(a, -b, r, n)
+}
+
+func mod1(a, b float64) float64 {
+	return a - b*math.Floor(a/b)
+}
+
+// fold a coordinate into a repeating cell of size centered on zero
+func repeat1(p, size float64) float64 {
+	half := size * 0.5
+	return mod1(p+half, size) - half
+}
+
+func rotate45(p Vec2) Vec2 {
+	return V2(p.X+p.Y, p.Y-p.X).Scale(math.Sqrt(0.5))
+}
+
+type SDFChamferUnion struct {
+	Items []SDF3
+	R     float64
+}
+
+func (s SDFChamferUnion) SDF() func(Vec3) float64 {
+	r := math.Max(0, s.R)
+	return blendUnion(s.Items, r, func(a, b float64) float64 {
+		return chamferUnion(a, b, r)
+	})
+}
+
+func (s SDFChamferUnion) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius + math.Max(0, s.R)
+}
+
+func (s SDFChamferUnion) Bounds() (Vec3, Vec3) {
+	lo, hi := itemsBoundsUnion(s.Items)
+	return boxGrow(lo, hi, math.Max(0, s.R))
+}
+
+// union with a 45° chamfer of size r filling the seams
+func ChamferUnion(r float64, items ...SDF3) SDF3 {
+	return SDFChamferUnion{items, r}
+}
+
+type SDFChamferDifference struct {
+	Items []SDF3
+	R     float64
+}
+
+func (s SDFChamferDifference) SDF() func(Vec3) float64 {
+	r := math.Max(0, s.R)
+	return blendDifference(s.Items, r, func(a, b float64) float64 {
+		return chamferDifference(a, b, r)
+	})
+}
+
+func (s SDFChamferDifference) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius
+}
+
+func (s SDFChamferDifference) Bounds() (Vec3, Vec3) {
+	return Bounds(s.Items[0])
+}
+
+// difference with a 45° chamfer of size r on the cut edges
+func ChamferDifference(r float64, items ...SDF3) SDF3 {
+	return SDFChamferDifference{items, r}
+}
+
+type SDFChamferIntersection struct {
+	Items []SDF3
+	R     float64
+}
+
+func (s SDFChamferIntersection) SDF() func(Vec3) float64 {
+	r := math.Max(0, s.R)
+	return blendIntersection(s.Items, func(a, b float64) float64 {
+		return chamferIntersection(a, b, r)
+	})
+}
+
+func (s SDFChamferIntersection) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius
+}
+
+func (s SDFChamferIntersection) Bounds() (Vec3, Vec3) {
+	return itemsBoundsIntersection(s.Items)
+}
+
+// intersection with a 45° chamfer of size r on the edges
+func ChamferIntersection(r float64, items ...SDF3) SDF3 {
+	return SDFChamferIntersection{items, r}
+}
+
+type SDFStairsUnion struct {
+	Items []SDF3
+	R     float64
+	N     int
+}
+
+func (s SDFStairsUnion) SDF() func(Vec3) float64 {
+	r, n := math.Max(0, s.R), s.N
+	return blendUnion(s.Items, r, func(a, b float64) float64 {
+		return stairsUnion(a, b, r, n)
+	})
+}
+
+func (s SDFStairsUnion) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius + math.Max(0, s.R)
+}
+
+func (s SDFStairsUnion) Bounds() (Vec3, Vec3) {
+	lo, hi := itemsBoundsUnion(s.Items)
+	return boxGrow(lo, hi, math.Max(0, s.R))
+}
+
+// union with n steps of total size r filling the seams
+func StairsUnion(r float64, n int, items ...SDF3) SDF3 {
+	return SDFStairsUnion{items, r, n}
+}
+
+type SDFStairsDifference struct {
+	Items []SDF3
+	R     float64
+	N     int
+}
+
+func (s SDFStairsDifference) SDF() func(Vec3) float64 {
+	r, n := math.Max(0, s.R), s.N
+	return blendDifference(s.Items, r, func(a, b float64) float64 {
+		return stairsDifference(a, b, r, n)
+	})
+}
+
+func (s SDFStairsDifference) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius
+}
+
+func (s SDFStairsDifference) Bounds() (Vec3, Vec3) {
+	return Bounds(s.Items[0])
+}
+
+// difference with n steps of total size r on the cut edges
+func StairsDifference(r float64, n int, items ...SDF3) SDF3 {
+	return SDFStairsDifference{items, r, n}
+}
+
+type SDFStairsIntersection struct {
+	Items []SDF3
+	R     float64
+	N     int
+}
+
+func (s SDFStairsIntersection) SDF() func(Vec3) float64 {
+	r, n := math.Max(0, s.R), s.N
+	return blendIntersection(s.Items, func(a, b float64) float64 {
+		return stairsIntersection(a, b, r, n)
+	})
+}
+
+func (s SDFStairsIntersection) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius
+}
+
+func (s SDFStairsIntersection) Bounds() (Vec3, Vec3) {
+	return itemsBoundsIntersection(s.Items)
+}
+
+// intersection with n steps of total size r on the edges
+func StairsIntersection(r float64, n int, items ...SDF3) SDF3 {
+	return SDFStairsIntersection{items, r, n}
+}
+
+type SDFColumnsUnion struct {
+	Items []SDF3
+	R     float64
+	N     int
+}
+
+func (s SDFColumnsUnion) SDF() func(Vec3) float64 {
+	r, n := math.Max(0, s.R), s.N
+	return blendUnion(s.Items, r, func(a, b float64) float64 {
+		return columnsUnion(a, b, r, n)
+	})
+}
+
+func (s SDFColumnsUnion) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius + math.Max(0, s.R)
+}
+
+func (s SDFColumnsUnion) Bounds() (Vec3, Vec3) {
+	lo, hi := itemsBoundsUnion(s.Items)
+	return boxGrow(lo, hi, math.Max(0, s.R))
+}
+
+// union with n rounded columns of total size r filling the seams
+func ColumnsUnion(r float64, n int, items ...SDF3) SDF3 {
+	return SDFColumnsUnion{items, r, n}
+}
+
+type SDFColumnsDifference struct {
+	Items []SDF3
+	R     float64
+	N     int
+}
+
+func (s SDFColumnsDifference) SDF() func(Vec3) float64 {
+	r, n := math.Max(0, s.R), s.N
+	return blendDifference(s.Items, r, func(a, b float64) float64 {
+		return columnsDifference(a, b, r, n)
+	})
+}
+
+func (s SDFColumnsDifference) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius
+}
+
+func (s SDFColumnsDifference) Bounds() (Vec3, Vec3) {
+	return Bounds(s.Items[0])
+}
+
+// difference with n rounded grooves of total size r on the cut edges
+func ColumnsDifference(r float64, n int, items ...SDF3) SDF3 {
+	return SDFColumnsDifference{items, r, n}
+}
+
+type SDFColumnsIntersection struct {
+	Items []SDF3
+	R     float64
+	N     int
+}
+
+func (s SDFColumnsIntersection) SDF() func(Vec3) float64 {
+	r, n := math.Max(0, s.R), s.N
+	return blendIntersection(s.Items, func(a, b float64) float64 {
+		return columnsIntersection(a, b, r, n)
+	})
+}
+
+func (s SDFColumnsIntersection) Sphere() (Vec3, float64) {
+	center, radius := itemsBoundingSphere(s.Items)
+	return center, radius
+}
+
+func (s SDFColumnsIntersection) Bounds() (Vec3, Vec3) {
+	return itemsBoundsIntersection(s.Items)
+}
+
+// intersection with n rounded grooves of total size r on the edges
+func ColumnsIntersection(r float64, n int, items ...SDF3) SDF3 {
+	return SDFColumnsIntersection{items, r, n}
+}
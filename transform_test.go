@@ -0,0 +1,211 @@
+package spt
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"testing"
+)
+
+func TestSmoothCombinators(t *testing.T) {
+	a := Sphere(500)
+	b := TranslateX(800, Sphere(500))
+
+	union := Union(a, b).SDF()
+	difference := Difference(a, b).SDF()
+	intersection := Intersection(a, b).SDF()
+
+	for _, k := range []float64{10, 100} {
+		for _, exp := range []bool{false, true} {
+			sunion := SDFSmoothUnion{[]SDF3{a, b}, k, exp}.SDF()
+			sdifference := SDFSmoothDifference{[]SDF3{a, b}, k, exp}.SDF()
+			sintersection := SDFSmoothIntersection{[]SDF3{a, b}, k, exp}.SDF()
+
+			for x := -1000.0; x <= 2000; x += 50 {
+				p := V3(x, 37, -11)
+				if d, h := sunion(p), union(p); d > h+1e-9 {
+					t.Errorf("smooth union k=%v exp=%v at %v: %v > %v", k, exp, p, d, h)
+				}
+				if d, h := sdifference(p), difference(p); d < h-1e-9 {
+					t.Errorf("smooth difference k=%v exp=%v at %v: %v < %v", k, exp, p, d, h)
+				}
+				if d, h := sintersection(p), intersection(p); d < h-1e-9 && h < 0 {
+					t.Errorf("smooth intersection k=%v exp=%v at %v: %v < %v", k, exp, p, d, h)
+				}
+			}
+
+			// away from the seam a polynomial blend has no effect
+			p := V3(-600, 0, 0)
+			if d, h := sunion(p), union(p); !exp && abs(d-h) > 1e-6 {
+				t.Errorf("smooth union k=%v exp=%v leaks at %v: %v != %v", k, exp, p, d, h)
+			}
+		}
+	}
+
+	// no blend radius, as a scene file that leaves it out gives, is no blend
+	for _, k := range []float64{0, -10} {
+		for _, exp := range []bool{false, true} {
+			sunion := SDFSmoothUnion{[]SDF3{a, b}, k, exp}
+			sdifference := SDFSmoothDifference{[]SDF3{a, b}, k, exp}.SDF()
+			sintersection := SDFSmoothIntersection{[]SDF3{a, b}, k, exp}.SDF()
+			for x := -1000.0; x <= 2000; x += 50 {
+				p := V3(x, 37, -11)
+				if d, h := sunion.SDF()(p), union(p); d != h {
+					t.Errorf("smooth union k=%v exp=%v at %v: %v, want %v", k, exp, p, d, h)
+				}
+				if d, h := sdifference(p), difference(p); d != h {
+					t.Errorf("smooth difference k=%v exp=%v at %v: %v, want %v", k, exp, p, d, h)
+				}
+				if d, h := sintersection(p), intersection(p); d != h && h < 0 {
+					t.Errorf("smooth intersection k=%v exp=%v at %v: %v, want %v", k, exp, p, d, h)
+				}
+			}
+			if _, r := sunion.Sphere(); r < 900 {
+				t.Errorf("smooth union k=%v exp=%v shrank to radius %v", k, exp, r)
+			}
+		}
+	}
+
+	// the fillet is pulled outward at the seam, and must stay in bounds
+	s := SmoothUnion(100, a, b)
+	center, radius := s.Sphere()
+	sdf := s.SDF()
+	seam := V3(400, 300, 0)
+	if sdf(seam) >= union(seam) {
+		t.Errorf("smooth union has no fillet at %v", seam)
+	}
+	for x := -1000.0; x <= 2000; x += 10 {
+		p := V3(x, 0, 0)
+		if sdf(p) < 0 && p.Sub(center).Length() > radius {
+			t.Errorf("smooth union surface at %v escapes sphere %v %v", p, center, radius)
+		}
+	}
+
+	// each pair blended pulls the surface out again, so more items reach
+	// further, and must stay in bounds too
+	for _, n := range []int{3, 5, 8} {
+		var items []SDF3
+		for i := 0; i < n; i++ {
+			items = append(items, Sphere(500))
+		}
+		for _, exp := range []bool{false, true} {
+			s := SDFSmoothUnion{items, 100, exp}
+			center, radius := s.Sphere()
+			lo, hi := s.Bounds()
+			sdf := s.SDF()
+			for x := 500.0; x < 1000; x++ {
+				p := V3(x, 0, 0)
+				if sdf(p) >= 0 {
+					break
+				}
+				if p.Sub(center).Length() > radius || boxDistance2(p, lo, hi) > 0 {
+					t.Errorf("smooth union of %d exp=%v surface at %v escapes sphere %v %v or box %v %v", n, exp, p, center, radius, lo, hi)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestMachinedCombinators(t *testing.T) {
+	a := Cube(1000, 1000, 1000)
+	b := TranslateZ(500, Cylinder(400, 300))
+	da, db := a.SDF(), b.SDF()
+
+	union := func(p Vec3) float64 { return min(da(p), db(p)) }
+	difference := func(p Vec3) float64 { return max(da(p), -db(p)) }
+	intersection := func(p Vec3) float64 { return max(da(p), db(p)) }
+
+	type variant struct {
+		name string
+		sdf  SDF3
+		want func(Vec3) float64
+		grow bool
+	}
+
+	variants := []variant{
+		{"ChamferUnion", ChamferUnion(50, a, b), union, true},
+		{"StairsUnion", StairsUnion(50, 4, a, b), union, true},
+		{"ColumnsUnion", ColumnsUnion(50, 4, a, b), union, true},
+		{"ChamferDifference", ChamferDifference(50, a, b), difference, false},
+		{"StairsDifference", StairsDifference(50, 4, a, b), difference, false},
+		{"ColumnsDifference", ColumnsDifference(50, 4, a, b), difference, false},
+		{"ChamferIntersection", ChamferIntersection(50, a, b), intersection, false},
+		{"StairsIntersection", StairsIntersection(50, 4, a, b), intersection, false},
+		{"ColumnsIntersection", ColumnsIntersection(50, 4, a, b), intersection, false},
+	}
+
+	for _, v := range variants {
+		sdf := v.sdf.SDF()
+		center, radius := v.sdf.Sphere()
+		for x := -1000.0; x <= 1000; x += 25 {
+			for z := -1000.0; z <= 1000; z += 25 {
+				p := V3(x, 13, z)
+				d, h := sdf(p), v.want(p)
+				// unions only ever add material, the rest only remove it
+				if v.grow && d > h+1e-6 || !v.grow && d < h-1e-6 && h < 0 {
+					t.Errorf("%s at %v: %v vs %v", v.name, p, d, h)
+				}
+				if d < 0 && p.Sub(center).Length() > radius {
+					t.Errorf("%s surface at %v escapes sphere %v %v", v.name, p, center, radius)
+				}
+			}
+		}
+	}
+
+	// no steps, or no size to share among them, is the plain operation
+	for _, c := range []struct {
+		r float64
+		n int
+	}{{50, 0}, {50, -3}, {0, 4}, {-50, 4}} {
+		for _, v := range []variant{
+			{"StairsUnion", StairsUnion(c.r, c.n, a, b), union, true},
+			{"ColumnsUnion", ColumnsUnion(c.r, c.n, a, b), union, true},
+			{"StairsDifference", StairsDifference(c.r, c.n, a, b), difference, false},
+			{"ColumnsDifference", ColumnsDifference(c.r, c.n, a, b), difference, false},
+			{"StairsIntersection", StairsIntersection(c.r, c.n, a, b), intersection, false},
+			{"ColumnsIntersection", ColumnsIntersection(c.r, c.n, a, b), intersection, false},
+		} {
+			sdf := v.sdf.SDF()
+			for x := -1000.0; x <= 1000; x += 50 {
+				p := V3(x, 13, 480)
+				if d := sdf(p); math.IsNaN(d) || c.r <= 0 && d != v.want(p) {
+					t.Fatalf("%s r=%v n=%d at %v: %v, want %v", v.name, c.r, c.n, p, d, v.want(p))
+				}
+			}
+		}
+	}
+
+	// the chamfer fills the seam between cube top and cylinder wall
+	seam := V3(320, 0, 510)
+	if d := ChamferUnion(50, a, b).SDF()(seam); d >= 0 {
+		t.Errorf("ChamferUnion has no chamfer at %v: %v", seam, d)
+	}
+}
+
+func TestCombinatorsGob(t *testing.T) {
+	a := Cube(1000, 1000, 1000)
+	b := TranslateZ(500, Cylinder(400, 300))
+
+	for _, sdf := range []SDF3{
+		SmoothUnion(50, a, b),
+		SmoothDifferenceExp(50, a, b),
+		ChamferUnion(50, a, b),
+		StairsDifference(50, 4, a, b),
+		ColumnsIntersection(50, 4, a, b),
+	} {
+		buf := new(bytes.Buffer)
+		in := Object(Steel, sdf)
+		if err := gob.NewEncoder(buf).Encode(&in); err != nil {
+			t.Fatal(err)
+		}
+		var out Thing
+		if err := gob.NewDecoder(buf).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		p := V3(320, 0, 510)
+		if d, e := sdf.SDF()(p), out.SDF3.SDF()(p); d != e {
+			t.Errorf("%T after gob: %v != %v", sdf, e, d)
+		}
+	}
+}
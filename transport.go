@@ -0,0 +1,191 @@
+package spt
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// How RPC connections are secured. The zero value is plain TCP with no
+// authentication. A Token sent over plain TCP can be sniffed, so use it
+// with TLS anywhere but a trusted network.
+type Transport struct {
+	TLS   *tls.Config // Optional, see ServerTLS and ClientTLS
+	Token string      // Optional shared secret both ends must hold
+}
+
+var errTokenRejected = errors.New("rpc token rejected")
+
+// how long either end waits for the other's handshake
+const handshakeTimeout = 10 * time.Second
+
+// Secure a connection accepted by a server, checking the client's token.
+func (t Transport) accept(conn net.Conn) (net.Conn, error) {
+	if t.TLS == nil && t.Token == "" {
+		return conn, nil
+	}
+	if t.TLS != nil {
+		conn = tls.Server(conn, t.TLS)
+	}
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := t.checkToken(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// Dial a server and present the token.
+func (t Transport) dial(ctx context.Context, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if t.TLS == nil && t.Token == "" {
+		return conn, nil
+	}
+	if t.TLS != nil {
+		config := t.TLS
+		if config.ServerName == "" {
+			host, _, _ := net.SplitHostPort(addr)
+			config = config.Clone()
+			config.ServerName = host
+		}
+		conn = tls.Client(conn, config)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(handshakeTimeout)
+	}
+	conn.SetDeadline(deadline)
+	if err := t.sendToken(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// The token goes as a length-prefixed frame, answered with a single byte.
+// Both ends exchange it whenever the transport isn't plain, even with no
+// token, so a client missing one is turned away rather than left waiting.
+func (t Transport) sendToken(conn net.Conn) error {
+	if len(t.Token) > 0xffff {
+		return errors.New("rpc token too long")
+	}
+	frame := make([]byte, 2, 2+len(t.Token))
+	binary.BigEndian.PutUint16(frame, uint16(len(t.Token)))
+	frame = append(frame, t.Token...)
+	if _, err := conn.Write(frame); err != nil {
+		return err
+	}
+	ack := []byte{0}
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		return err
+	}
+	if ack[0] != 1 {
+		return errTokenRejected
+	}
+	return nil
+}
+
+func (t Transport) checkToken(conn net.Conn) error {
+	var size uint16
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return err
+	}
+	token := make([]byte, size)
+	if _, err := io.ReadFull(conn, token); err != nil {
+		return err
+	}
+	if t.Token != "" && subtle.ConstantTimeCompare(token, []byte(t.Token)) != 1 {
+		conn.Write([]byte{0})
+		return errTokenRejected
+	}
+	_, err := conn.Write([]byte{1})
+	return err
+}
+
+func loadPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+	return pool, nil
+}
+
+// TLS for a server from PEM files. With caFile set, clients must present
+// a certificate signed by it, and servers dialled with the same config
+// (as a Farm does its workers) must be signed by it too.
+func ServerTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile != "" {
+		if config.ClientCAs, err = loadPool(caFile); err != nil {
+			return nil, err
+		}
+		config.RootCAs = config.ClientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// TLS for a client from PEM files. caFile verifies the server, or leave
+// it empty to use the system roots. certFile and keyFile are the client
+// certificate, if the server wants one.
+func ClientTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	var err error
+	if caFile != "" {
+		if config.RootCAs, err = loadPool(caFile); err != nil {
+			return nil, err
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Transports from PEM files and a token, for a worker or coordinator to
+// accept connections with and to dial out with. Without certFile there
+// is no TLS.
+func Transports(certFile, keyFile, caFile, token string) (serve, dial Transport, err error) {
+	serve.Token = token
+	dial.Token = token
+	if certFile != "" {
+		if serve.TLS, err = ServerTLS(certFile, keyFile, caFile); err != nil {
+			return
+		}
+		if dial.TLS, err = ClientTLS(certFile, keyFile, caFile); err != nil {
+			return
+		}
+	}
+	return
+}
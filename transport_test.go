@@ -0,0 +1,209 @@
+package spt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"image"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// a certificate and key, as PEM files in dir
+type testCert struct {
+	cert              *x509.Certificate
+	key               *ecdsa.PrivateKey
+	certFile, keyFile string
+}
+
+// Issue a certificate signed by ca, or self-signed when ca is nil.
+func issue(t *testing.T, dir, name string, ca *testCert, serial int64) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".pem"),
+		keyFile:  filepath.Join(dir, name+"-key.pem"),
+	}
+	write := func(file, kind string, der []byte) {
+		if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(c.certFile, "CERTIFICATE", der)
+	write(c.keyFile, "EC PRIVATE KEY", keyDer)
+	return c
+}
+
+// a worker on loopback behind transport
+func testSecureWorker(t *testing.T, transport Transport) (string, func()) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newRenderServer(newSceneCache(sceneCacheSize))
+	go func() {
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				secure, err := transport.accept(conn)
+				if err != nil {
+					return
+				}
+				server.ServeConn(secure)
+			}()
+		}
+	}()
+	return listen.Addr().String(), func() { listen.Close() }
+}
+
+func renderVia(addr string, transport Transport) error {
+	renderer := NewRPCRendererWith(addr, transport).(RPCRenderer)
+	defer renderer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	scene := tinyScene()
+	_, err := renderer.RenderTile(ctx, scene, Tile{Region: image.Rect(0, 0, 8, 8), Samples: 1}, nil)
+	return err
+}
+
+func TestTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spt-transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := issue(t, dir, "ca", nil, 1)
+	server := issue(t, dir, "server", ca, 2)
+	client := issue(t, dir, "client", ca, 3)
+	rogue := issue(t, dir, "rogue", nil, 4)
+
+	serverTLS, err := ServerTLS(server.certFile, server.keyFile, ca.certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTLS, err := ClientTLS(client.certFile, client.keyFile, ca.certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonTLS, err := ClientTLS("", "", ca.certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rogueTLS, err := ClientTLS(rogue.certFile, rogue.keyFile, ca.certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ServerTLS(server.certFile, server.keyFile, server.keyFile); err == nil {
+		t.Error("loaded a CA pool from a key")
+	}
+
+	secure, stopSecure := testSecureWorker(t, Transport{TLS: serverTLS, Token: "sesame"})
+	defer stopSecure()
+	tokenOnly, stopTokenOnly := testSecureWorker(t, Transport{Token: "sesame"})
+	defer stopTokenOnly()
+
+	for _, c := range []struct {
+		name      string
+		addr      string
+		transport Transport
+		ok        bool
+	}{
+		{"tls and token", secure, Transport{TLS: clientTLS, Token: "sesame"}, true},
+		{"wrong token", secure, Transport{TLS: clientTLS, Token: "open"}, false},
+		{"no token", secure, Transport{TLS: clientTLS}, false},
+		{"no client certificate", secure, Transport{TLS: anonTLS, Token: "sesame"}, false},
+		{"untrusted client certificate", secure, Transport{TLS: rogueTLS, Token: "sesame"}, false},
+		{"plain tcp", secure, Transport{Token: "sesame"}, false},
+		{"token over tcp", tokenOnly, Transport{Token: "sesame"}, true},
+		{"wrong token over tcp", tokenOnly, Transport{Token: "open"}, false},
+	} {
+		err := renderVia(c.addr, c.transport)
+		if c.ok && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: rendered", c.name)
+		}
+	}
+
+	// the server must be who the CA says it is
+	other := &tls.Config{RootCAs: x509.NewCertPool(), Certificates: clientTLS.Certificates}
+	if err := renderVia(secure, Transport{TLS: other, Token: "sesame"}); err == nil {
+		t.Error("trusted an unknown server")
+	}
+}
+
+func TestFarmTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spt-transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := issue(t, dir, "ca", nil, 1)
+	node := issue(t, dir, "node", ca, 2)
+	config, err := ServerTLS(node.certFile, node.keyFile, ca.certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := Transport{TLS: config, Token: "sesame"}
+
+	farm, coordinator, stopFarm := testFarm(t, transport)
+	defer stopFarm()
+
+	addr, stopWorker := testSecureWorker(t, transport)
+	defer stopWorker()
+	stop := make(chan struct{})
+	defer close(stop)
+	go JoinFarmWith(stop, coordinator, port(t, addr), transport)
+	waitFor(t, "the worker to join", func() bool { return len(farm.members()) == 1 })
+
+	farmRender(t, farm)
+}